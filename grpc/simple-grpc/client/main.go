@@ -2,17 +2,44 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"time"
 
+	"example.com/simple-grpc/grpctrace"
 	pb "example.com/simple-grpc/hello"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	// Local
+	"local/shared/logging"
+	"local/shared/tracing"
 )
 
+// TRACE_EXPORTER=file go run ./client, then see the client and server spans of a trace on traces.jsonl
 func main() {
-	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	logging.Setup("grpc-client")
+	closeTraces, err := tracing.Setup("grpc-client")
+	if err != nil {
+		logging.Fatal("Invalid tracing config", logging.Err(err))
+	}
+
+	// logging.Fatal exits without running deferred calls, the spans are written first
+	err = run()
+	if closeErr := closeTraces(); closeErr != nil {
+		slog.Error("Could not write the traces", logging.Err(closeErr))
+	}
+	if err != nil {
+		logging.Fatal("gRPC client failed", logging.Err(err))
+	}
+}
+
+func run() error {
+	conn, err := grpc.NewClient("localhost:50051",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(grpctrace.UnaryClientInterceptor))
 	if err != nil {
-		log.Fatalf("‼️ could not connect: %v", err)
+		return fmt.Errorf("could not connect: %w", err)
 	}
 	defer conn.Close()
 
@@ -21,10 +48,15 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
+	// The root span of the trace, the call is its child
+	ctx, span := tracing.Start(ctx, "say hello", tracing.KindInternal)
 	resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Herman"})
+	span.SetError(err)
+	span.End()
 	if err != nil {
-		log.Fatalf("‼️ error calling SayHello: %v", err)
+		return fmt.Errorf("calling SayHello: %w", err)
 	}
 
-	log.Printf("✅ Got server response: %s", resp.Message)
+	slog.InfoContext(ctx, "Got server response", "message", resp.Message)
+	return nil
 }
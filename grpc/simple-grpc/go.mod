@@ -1,8 +1,6 @@
 module example.com/simple-grpc
 
-go 1.23.0
-
-toolchain go1.24.3
+go 1.24.3
 
 require (
 	google.golang.org/grpc v1.73.0
@@ -15,3 +13,7 @@ require (
 	golang.org/x/text v0.23.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250324211829-b45e905df463 // indirect
 )
+
+require local/shared v0.0.0-00010101000000-000000000000
+
+replace local/shared => ../../shared
@@ -0,0 +1,66 @@
+// Package grpctrace propagates W3C trace context (see local/shared/tracing) on gRPC
+// metadata, with client and server interceptors.
+package grpctrace
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	// Local
+	"local/shared/tracing"
+)
+
+// UnaryServerInterceptor starts a server span per call, child of the traceparent metadata
+// when the client sent it.
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if remote, ok := extract(md); ok {
+			ctx = tracing.ContextWithRemote(ctx, remote)
+		}
+	}
+	ctx, span := tracing.Start(ctx, info.FullMethod, tracing.KindServer)
+	defer span.End()
+	span.SetAttr("rpc.method", info.FullMethod)
+
+	resp, err := handler(ctx, req)
+	span.SetAttr("rpc.grpc.status_code", status.Code(err).String())
+	span.SetError(err)
+	return resp, err
+}
+
+// UnaryClientInterceptor starts a client span per call and sends its traceparent as metadata.
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, span := tracing.Start(ctx, method, tracing.KindClient)
+	defer span.End()
+	span.SetAttr("rpc.method", method)
+	span.SetAttr("server.address", cc.Target())
+
+	sc := span.SpanContext()
+	ctx = metadata.AppendToOutgoingContext(ctx, tracing.TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, tracing.TracestateHeader, sc.TraceState)
+	}
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	span.SetAttr("rpc.grpc.status_code", status.Code(err).String())
+	span.SetError(err)
+	return err
+}
+
+func extract(md metadata.MD) (tracing.SpanContext, bool) {
+	values := md.Get(tracing.TraceparentHeader)
+	if len(values) != 1 {
+		return tracing.SpanContext{}, false
+	}
+	sc, err := tracing.ParseTraceparent(values[0])
+	if err != nil {
+		return tracing.SpanContext{}, false
+	}
+	if state := md.Get(tracing.TracestateHeader); len(state) > 0 {
+		sc.TraceState = state[0]
+	}
+	return sc, true
+}
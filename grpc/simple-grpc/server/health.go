@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	pb "example.com/simple-grpc/hello"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	// Local
+	"local/shared/health"
+)
+
+// serveHealth registers the standard gRPC health service on s, serving the readiness of
+// health.Default for the whole server ("") and HelloService, refreshed every interval:
+//
+//	grpc_health_probe -addr=localhost:50051
+func serveHealth(ctx context.Context, s *grpc.Server, interval time.Duration) {
+	healthServer := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	update := func() {
+		status := healthpb.HealthCheckResponse_SERVING
+		if !health.Default.Check(ctx).Ready() {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		for _, service := range []string{"", pb.HelloService_ServiceDesc.ServiceName} {
+			healthServer.SetServingStatus(service, status)
+		}
+	}
+	update()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// NOT_SERVING from now on, so clients stop sending calls while draining
+				healthServer.Shutdown()
+				return
+			case <-ticker.C:
+				update()
+			}
+		}
+	}()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	// Local
+	"local/shared/logging"
+	"local/shared/metrics"
+)
+
+var (
+	grpcHandled = metrics.NewCounter("grpc_server_handled_total",
+		"gRPC calls completed by method and status code.", "method", "code")
+	grpcDuration = metrics.NewHistogram("grpc_server_handling_seconds",
+		"gRPC call latencies by method.", metrics.DefBuckets, "method")
+)
+
+// logUnary logs every unary call with its method, status code and duration.
+// The method is added to the context as the route, so the handler logs carry it too.
+func logUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx = logging.With(ctx, logging.Route(info.FullMethod))
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	attrs := []any{"code", status.Code(err).String(), "duration", time.Since(start)}
+	if err != nil {
+		slog.ErrorContext(ctx, "gRPC call failed", append(attrs, logging.Err(err))...)
+	} else {
+		slog.InfoContext(ctx, "gRPC call", attrs...)
+	}
+	return resp, err
+}
+
+// metricsUnary counts every unary call, e.g. /hello.HelloService/SayHello, and its latency.
+func metricsUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	grpcDuration.With(info.FullMethod).Observe(time.Since(start).Seconds())
+	grpcHandled.With(info.FullMethod, status.Code(err).String()).Inc()
+	return resp, err
+}
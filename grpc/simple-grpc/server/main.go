@@ -3,11 +3,24 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"example.com/simple-grpc/grpctrace"
 	pb "example.com/simple-grpc/hello" // pb - alias to access protobuff generated code
 	"google.golang.org/grpc"           // imports grpc framework
+
+	// Local
+	"local/shared"
+	"local/shared/health"
+	"local/shared/logging"
+	"local/shared/metrics"
+	"local/shared/tracing"
 )
 
 // Represents the Server
@@ -26,21 +39,52 @@ type helloServer struct {
 //     Where `*pb.HelloResponse` is the server response.
 //     Java: `HelloResponse sayHello(...) throws Exception { ... }`
 func (s *helloServer) SayHello(ctx context.Context, clientRequest *pb.HelloRequest) (*pb.HelloResponse, error) {
-	log.Printf("✅ Request Received: '%s'", clientRequest.Name)
+	slog.InfoContext(ctx, "Request received", "name", clientRequest.Name)
 	return &pb.HelloResponse{Message: fmt.Sprintf("Hello, %s!", clientRequest.Name)}, nil
 }
 
+// adminAddr serves /metrics, /healthz and /readyz over HTTP, e.g. curl localhost:9091/metrics
+const adminAddr = ":9091"
+
 func main() {
+	logging.Setup("grpc")
+	closeTraces, err := tracing.Setup("grpc")
+	if err != nil {
+		logging.Fatal("Invalid tracing config", logging.Err(err))
+	}
+	defer closeTraces()
+
 	lis, err := net.Listen("tcp", ":50051")
 	if err != nil {
-		log.Fatalf("‼️ failed to listen: %v", err)
+		logging.Fatal("Failed to listen", logging.Err(err))
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(grpctrace.UnaryServerInterceptor, logUnary, metricsUnary))
 	pb.RegisterHelloServiceServer(grpcServer, &helloServer{})
 
-	log.Println("✅ gRPC server listening on :50051")
+	// Stop both servers on Ctrl+C, waiting for in flight calls
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		grpcServer.GracefulStop()
+	}()
+
+	serveHealth(ctx, grpcServer, 5*time.Second)
+
+	// Prometheus and curl speak HTTP, so metrics and health get their own port
+	admin := http.NewServeMux()
+	admin.Handle("GET /metrics", metrics.Handler())
+	health.Handle(admin)
+	go func() {
+		if err := shared.RunServerContext(ctx, adminAddr, admin, shared.WithName("gRPC admin")); err != nil {
+			slog.Error("Admin server failed", logging.Err(err))
+		}
+	}()
+
+	slog.Info("gRPC server listening", "addr", lis.Addr().String())
 	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("‼️ failed to serve: %v", err)
+		closeTraces() // logging.Fatal skips the deferred calls
+		logging.Fatal("Failed to serve", logging.Err(err))
 	}
 }
@@ -0,0 +1,7 @@
+module pinning
+
+go 1.24.3
+
+require local/shared v0.0.0-00010101000000-000000000000
+
+replace local/shared => ../../shared
@@ -2,22 +2,44 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
+
+	// Local
+	"local/shared"
+	"local/shared/faults"
+	"local/shared/health"
+	"local/shared/logging"
+	"local/shared/metrics"
+	"local/shared/middleware"
+)
+
+const (
+	certFile = "cert.pem"
+	keyFile  = "key.pem"
 )
 
 func handler(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("✅ Got Request:", r.Method, r.URL.Path)
+	slog.InfoContext(r.Context(), "Got request", "method", r.Method, "path", r.URL.Path)
 	fmt.Fprintln(w, `{"message": "Hello, HTTPS from Go!"}`)
 }
 
-// $ go run mock_pinning.go
+// $ go run .
 // Test: curl -k https://localhost:8443
 func main() {
+	logging.Setup("pinning")
 	http.HandleFunc("/", handler)
+	http.Handle("GET /metrics", metrics.Handler())
+	// Readiness fails when cert.pem expires within a day, regenerate it as on README.md
+	health.Add("tls", health.CertificateCheck(certFile, 24*time.Hour))
+	health.Handle(nil)
+	// FAULTS_FILE rules, and /admin/faults when FAULTS_ADMIN is true, to test clients on flaky networks
+	if err := faults.Setup(nil); err != nil {
+		logging.Fatal("Invalid fault rules", logging.Err(err))
+	}
 
-	fmt.Println("Listening on https://localhost:8443")
-	err := http.ListenAndServeTLS(":8443", "cert.pem", "key.pem", nil)
-	if err != nil {
-		panic(err)
+	if err := shared.RunServer(":8443", middleware.Default(nil), shared.WithName("Pinning Server"), shared.WithTLS(certFile, keyFile)); err != nil {
+		logging.Fatal("Pinning Server failed", logging.Err(err))
 	}
 }
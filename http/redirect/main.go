@@ -1,12 +1,27 @@
 package main
 
 import (
+	_ "embed"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
+
+	// Local
+	"local/shared"
+	"local/shared/faults"
+	"local/shared/health"
+	"local/shared/logging"
+	"local/shared/metrics"
+	"local/shared/middleware"
+	"local/shared/openapi"
 )
 
+// openapiSpec documents the routes, see openapi.Setup
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
 const (
 	defaultUser      = "guest"
 	defaultReturnURL = "singletopactivity://callback"
@@ -27,6 +42,7 @@ func redirectHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Generate token
 	generatedToken := fmt.Sprintf("%06d", rand.Intn(900000)+100000) // 100000..999999
+	slog.InfoContext(r.Context(), "Redirect page served", logging.UserID(user), "return_url", returnURL)
 	redirectSuccess := fmt.Sprintf("%s?success=true&user=%s&token=%s", returnURL, user, generatedToken)
 	redirectError := fmt.Sprintf("%s?success=false&user=%s", returnURL, user)
 
@@ -66,11 +82,24 @@ func redirectHandler(w http.ResponseWriter, r *http.Request) {
         `, user, generatedToken, redirectSuccess, redirectError, redirectSuccess, redirectError)))
 }
 
-// go run main.go
+// go run .
 // Desktop: http://localhost:8080/redirect?user=herman
 // Android Emulator: http://10.0.2.2:8080/redirect?user=herman
 func main() {
+	logging.Setup("redirect")
 	http.HandleFunc("/redirect", redirectHandler)
-	log.Println("🚀 Server running on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	http.Handle("GET /metrics", metrics.Handler())
+	health.Handle(nil)
+	// FAULTS_FILE rules, and /admin/faults when FAULTS_ADMIN is true, to test clients on flaky networks
+	if err := faults.Setup(nil); err != nil {
+		logging.Fatal("Invalid fault rules", logging.Err(err))
+	}
+	// GET /openapi.json, requests not matching it are answered with a problem
+	validate, err := openapi.Setup(nil, openapiSpec)
+	if err != nil {
+		logging.Fatal("Invalid OpenAPI document", logging.Err(err))
+	}
+	if err := shared.RunServer(":8080", middleware.Default(validate(http.DefaultServeMux)), shared.WithName("Redirect Server")); err != nil {
+		logging.Fatal("Redirect Server failed", logging.Err(err))
+	}
 }
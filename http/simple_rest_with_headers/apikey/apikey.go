@@ -0,0 +1,204 @@
+// Package apikey authenticates X-API-KEY headers against a file of hashed keys,
+// with names, scopes, expiry and a disabled flag:
+//
+//	{"keys": [
+//	  {"name": "android-2025", "hash": "sha256:9f86...", "scopes": ["hello:read"], "expires": "2026-01-01T00:00:00Z"},
+//	  {"name": "android-2024", "hash": "sha256:60303...", "scopes": ["hello:read"], "disabled": true}
+//	]}
+//
+// Several keys may be active at once, so clients can move to a new key before the old one is disabled.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header carries the API key.
+const Header = "X-API-KEY"
+
+const hashPrefix = "sha256:"
+
+// Authentication errors, all of them are answered with a 401.
+var (
+	ErrMissing  = errors.New("missing API key")
+	ErrInvalid  = errors.New("invalid API key")
+	ErrExpired  = errors.New("expired API key")
+	ErrDisabled = errors.New("disabled API key")
+)
+
+// Key is an entry of the key file.
+type Key struct {
+	Name string `json:"name"`
+	// Hash is "sha256:" and the hex SHA-256 of the key, see Hash
+	Hash   string   `json:"hash,omitempty"`
+	Scopes []string `json:"scopes"`
+	// Expires is optional, the key doesn't expire when zero
+	Expires  time.Time `json:"expires,omitzero"`
+	Disabled bool      `json:"disabled,omitempty"`
+
+	hash []byte
+}
+
+// HasScope reports whether the key grants scope, "*" grants every scope.
+func (k *Key) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, "*")
+}
+
+// Expired reports whether the key is expired at now.
+func (k *Key) Expired(now time.Time) bool {
+	return !k.Expires.IsZero() && !now.Before(k.Expires)
+}
+
+type keyFile struct {
+	Keys []*Key `json:"keys"`
+}
+
+// Hash returns the hash of key to store on the key file.
+// Keys are random (see Generate), so a fast hash is enough: there's nothing to guess from it.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// Generate returns a new random key.
+func Generate() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return "mock_" + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Store holds the keys of a file.
+type Store struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    []*Key
+	modTime time.Time
+}
+
+// Load reads the key file at path.
+func Load(path string) (*Store, error) {
+	s := &Store{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the key file again, keeping the previous keys when it's invalid.
+func (s *Store) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	names := map[string]bool{}
+	for i, key := range file.Keys {
+		if key.Name == "" {
+			return fmt.Errorf("%s: key %d: missing name", s.path, i)
+		}
+		if names[key.Name] {
+			return fmt.Errorf("%s: duplicate key %q", s.path, key.Name)
+		}
+		names[key.Name] = true
+		hash, ok := strings.CutPrefix(key.Hash, hashPrefix)
+		if !ok {
+			return fmt.Errorf("%s: key %q: hash must start with %q", s.path, key.Name, hashPrefix)
+		}
+		if key.hash, err = hex.DecodeString(hash); err != nil || len(key.hash) != sha256.Size {
+			return fmt.Errorf("%s: key %q: invalid SHA-256 hash", s.path, key.Name)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys, s.modTime = file.Keys, info.ModTime()
+	return nil
+}
+
+// Watch reloads the key file every interval when it changed, until ctx is done, so keys can be
+// added and disabled while running.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(s.path)
+		s.mu.RLock()
+		changed := err == nil && !info.ModTime().Equal(s.modTime)
+		s.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := s.Reload(); err != nil {
+			slog.Error("Keeping the previous API keys", "error", err)
+			continue
+		}
+		slog.Info("🔑 API keys reloaded", "file", s.path)
+	}
+}
+
+// Authenticate returns the key matching key. Every stored hash is compared in constant time,
+// so the response time doesn't tell which keys exist.
+func (s *Store) Authenticate(key string) (*Key, error) {
+	if key == "" {
+		return nil, ErrMissing
+	}
+	sum := sha256.Sum256([]byte(key))
+
+	s.mu.RLock()
+	var match *Key
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare(sum[:], k.hash) == 1 {
+			match = k
+		}
+	}
+	s.mu.RUnlock()
+
+	switch {
+	case match == nil:
+		return nil, ErrInvalid
+	case match.Disabled:
+		return nil, ErrDisabled
+	case match.Expired(time.Now()):
+		return nil, ErrExpired
+	}
+	return match, nil
+}
+
+// Keys returns the keys, without their hashes.
+func (s *Store) Keys() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]Key, len(s.keys))
+	for i, k := range s.keys {
+		keys[i] = Key{Name: k.Name, Scopes: k.Scopes, Expires: k.Expires, Disabled: k.Disabled}
+	}
+	return keys
+}
@@ -0,0 +1,50 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	// Local
+	"local/shared/problem"
+)
+
+type keyContext struct{}
+
+// FromContext returns the key authenticated by Require.
+func FromContext(ctx context.Context) (*Key, bool) {
+	key, ok := ctx.Value(keyContext{}).(*Key)
+	return key, ok
+}
+
+// Require answers 401 when the X-API-KEY header is missing, unknown, expired or disabled,
+// and 403 when the key lacks any of scopes:
+//
+//	mux.Handle("GET /hello", store.Require("hello:read")(http.HandlerFunc(helloHandler)))
+func (s *Store) Require(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, err := s.Authenticate(r.Header.Get(Header))
+			if err != nil {
+				slog.WarnContext(r.Context(), "API key rejected", "error", err)
+				w.Header().Set("WWW-Authenticate", `APIKey header="`+Header+`"`)
+				p := problem.Unauthorized(err.Error())
+				if errors.Is(err, ErrExpired) || errors.Is(err, ErrDisabled) {
+					p.With("reason", strings.TrimSuffix(err.Error(), " API key"))
+				}
+				problem.Write(w, r, p)
+				return
+			}
+			for _, scope := range scopes {
+				if !key.HasScope(scope) {
+					slog.WarnContext(r.Context(), "API key lacks scope", "key", key.Name, "scope", scope)
+					problem.Write(w, r, problem.Forbidden("API key lacks the "+scope+" scope").With("required_scope", scope))
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyContext{}, key)))
+		})
+	}
+}
@@ -0,0 +1,38 @@
+// Command apikey generates an API key and the entry to add to the key file:
+//
+//	go run ./cmd/apikey -name android-2025 -scopes hello:read -expires 2160h
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"simple_rest_with_headers/apikey"
+)
+
+func main() {
+	name := flag.String("name", "", "key name, e.g. android-2025 (required)")
+	scopes := flag.String("scopes", "hello:read", "comma separated scopes, * for all")
+	expires := flag.Duration("expires", 0, "lifetime of the key, e.g. 2160h, it never expires when 0")
+	flag.Parse()
+	if *name == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	key := apikey.Generate()
+	entry := apikey.Key{Name: *name, Hash: apikey.Hash(key), Scopes: strings.Split(*scopes, ",")}
+	if *expires > 0 {
+		entry.Expires = time.Now().Add(*expires).UTC().Truncate(time.Second)
+	}
+	data, _ := json.Marshal(entry)
+
+	fmt.Fprintln(os.Stderr, "🔑 Key, shown only once:")
+	fmt.Println(key)
+	fmt.Fprintln(os.Stderr, "Add to the keys of apikeys.json:")
+	fmt.Println(string(data))
+}
@@ -0,0 +1,129 @@
+// Command jwt generates the JWKS of the REST mock and mints tokens offline:
+//
+//	go run ./cmd/jwt keygen                                 # writes jwks.private.json and jwks.json
+//	go run ./cmd/jwt mint -alg ES256 -scope "profile:read"  # valid for 1h
+//	go run ./cmd/jwt mint -ttl -1h                          # expired
+//	go run ./cmd/jwt mint -nbf 1h                           # not valid yet
+//	go run ./cmd/jwt mint -aud other-app                    # wrong audience
+//	go run ./cmd/jwt mint -bad-signature                    # signed with another key of the same kid
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"simple_rest_with_headers/jwtauth"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		err = keygen(os.Args[2:])
+	case "mint":
+		err = mint(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "‼️", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: jwt keygen [flags] | jwt mint [flags], -h for the flags")
+	os.Exit(2)
+}
+
+// keygen writes a private key of every algorithm, and the key set of the server.
+// The server set has the public RSA and EC keys, and the HS256 secret, shared by nature.
+func keygen(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	privateFile := flags.String("private", "jwks.private.json", "private key set, used by mint")
+	serverFile := flags.String("server", "jwks.json", "key set of the server")
+	flags.Parse(args)
+
+	var private, server jwtauth.JWKS
+	for _, alg := range []string{jwtauth.RS256, jwtauth.ES256, jwtauth.HS256} {
+		k, err := jwtauth.GenerateJWK(alg, "dev-"+alg)
+		if err != nil {
+			return err
+		}
+		private.Keys = append(private.Keys, k)
+		if public, ok := k.Public(); ok {
+			k = public
+		}
+		server.Keys = append(server.Keys, k)
+	}
+	if err := writeJSON(*privateFile, private); err != nil {
+		return err
+	}
+	if err := writeJSON(*serverFile, server); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "🔑 Wrote %s and %s\n", *privateFile, *serverFile)
+	return nil
+}
+
+func mint(args []string) error {
+	flags := flag.NewFlagSet("mint", flag.ExitOnError)
+	keysFile := flags.String("keys", "jwks.private.json", "private key set")
+	alg := flags.String("alg", jwtauth.RS256, "RS256, ES256 or HS256")
+	kid := flags.String("kid", "", "key ID, the only key of -alg when empty")
+	issuer := flags.String("iss", "mock-rest", "issuer")
+	audience := flags.String("aud", "android-app", "audience")
+	subject := flags.String("sub", "user-1", "subject")
+	scope := flags.String("scope", "profile:read", "space separated scopes")
+	ttl := flags.Duration("ttl", time.Hour, "lifetime, negative for an expired token")
+	notBefore := flags.Duration("nbf", 0, "delay before the token is valid")
+	badSignature := flags.Bool("bad-signature", false, "sign with a new key with the same kid")
+	flags.Parse(args)
+
+	set, err := jwtauth.ReadJWKS(*keysFile)
+	if err != nil {
+		return err
+	}
+	key, err := set.Key(*kid, *alg)
+	if err != nil {
+		return err
+	}
+	if *badSignature {
+		if key, err = jwtauth.GenerateJWK(key.Alg, key.Kid); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	claims := &jwtauth.Claims{
+		Issuer:    *issuer,
+		Subject:   *subject,
+		Audience:  jwtauth.StringList{*audience},
+		IssuedAt:  jwtauth.NewNumericDate(now),
+		ExpiresAt: jwtauth.NewNumericDate(now.Add(*ttl)),
+		Scope:     *scope,
+	}
+	if *notBefore != 0 {
+		claims.NotBefore = jwtauth.NewNumericDate(now.Add(*notBefore))
+	}
+	token, err := jwtauth.Sign(claims, key)
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
@@ -0,0 +1,104 @@
+// Command recproxy records the traffic of an upstream API, and replays it offline:
+//
+//	go run ./cmd/recproxy -record https://api-m.sandbox.paypal.com -dir recordings/paypal
+//	go run ./cmd/recproxy -dir recordings/paypal -match query,body
+//	go run ./cmd/recproxy -dir recordings/paypal -fixtures fixtures/paypal.yaml
+//
+// Point the client at it, e.g. PAYPAL_BASE_URL=http://localhost:8082 for the PayPal server.
+// Recordings aren't fixtures, -fixtures converts them to the routes of the REST mock.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	// Local
+	"local/shared"
+	"local/shared/logging"
+	"local/shared/middleware"
+	"simple_rest_with_headers/recorder"
+)
+
+func main() {
+	addr := flag.String("addr", ":8082", "listen address")
+	upstream := flag.String("record", "", "upstream URL to forward and record, replay the recordings when empty")
+	dir := flag.String("dir", "recordings", "recordings directory")
+	match := flag.String("match", recorder.DefaultRules.String(), "replay match rules: method,path and query, body, header:<name>")
+	redactHeaders := flag.String("redact-headers", "", "comma separated headers to redact besides the defaults")
+	redactFields := flag.String("redact-fields", "", "comma separated JSON, form and query fields to redact besides the defaults")
+	fixturesFile := flag.String("fixtures", "", "write the recordings of -dir as a fixtures file of the REST mock, then exit")
+	flag.Parse()
+
+	logging.Setup("mock-proxy")
+	rules, err := recorder.ParseRules(*match)
+	if err != nil {
+		logging.Fatal("Invalid -match", logging.Err(err))
+	}
+	if *fixturesFile != "" {
+		if err := writeFixtures(*dir, *fixturesFile, rules); err != nil {
+			logging.Fatal("Converting the recordings failed", logging.Err(err))
+		}
+		return
+	}
+	opts := []recorder.Option{
+		recorder.WithRules(rules),
+		recorder.WithRedactedHeaders(split(*redactHeaders)...),
+		recorder.WithRedactedFields(split(*redactFields)...),
+	}
+
+	var handler http.Handler
+	name := "Replay Proxy"
+	if *upstream != "" {
+		u, err := url.Parse(*upstream)
+		if err != nil || u.Host == "" {
+			logging.Fatal("Invalid -record upstream URL", "url", *upstream)
+		}
+		if handler, err = recorder.NewRecorder(u, *dir, opts...); err != nil {
+			logging.Fatal("Recording failed", logging.Err(err))
+		}
+		name = "Record Proxy of " + u.Host
+	} else if handler, err = recorder.LoadReplayer(*dir, opts...); err != nil {
+		logging.Fatal("Loading recordings failed", logging.Err(err))
+	}
+
+	if err := shared.RunServer(*addr, middleware.Default(handler), shared.WithName(name)); err != nil {
+		logging.Fatal(name+" failed", logging.Err(err))
+	}
+}
+
+// writeFixtures converts the recordings of dir to the fixtures file path.
+func writeFixtures(dir, path string, rules recorder.Rules) error {
+	recordings, err := recorder.LoadDir(dir)
+	if err != nil {
+		return err
+	}
+	file, skipped := recorder.Fixtures(recordings, rules)
+	if len(skipped) > 0 {
+		slog.Warn("Skipped recordings with a binary body", "recordings", skipped)
+	}
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(file); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		return err
+	}
+	slog.Info("Fixtures written", "file", path, "routes", len(file.Routes))
+	return nil
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,70 @@
+// Command signedreq sends a request signed by hmacauth, the reference for other clients:
+//
+//	go run ./cmd/signedreq -X POST -d '{"amount":1000,"currency":"EUR"}' http://localhost:8080/payments
+//
+// -v prints the string to sign and the headers, to compare with another implementation.
+// -repeat 2 sends the same signed request twice, the second is rejected as a replay.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"simple_rest_with_headers/hmacauth"
+)
+
+func main() {
+	method := flag.String("X", http.MethodGet, "request method")
+	data := flag.String("d", "", "request body")
+	keyID := flag.String("key-id", "android-dev", "signing key ID")
+	secret := flag.String("secret", os.Getenv("HMAC_SECRET"), "signing secret, $HMAC_SECRET by default")
+	verbose := flag.Bool("v", false, "print the string to sign and the signature headers")
+	repeat := flag.Int("repeat", 1, "times to send the same signed request")
+	flag.Parse()
+	if flag.NArg() != 1 || *secret == "" {
+		fmt.Fprintln(os.Stderr, "usage: signedreq [flags] -secret <secret> <url>")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	req, err := http.NewRequest(*method, flag.Arg(0), bytes.NewBufferString(*data))
+	if err != nil {
+		fail(err)
+	}
+	if *data != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := (hmacauth.Signer{KeyID: *keyID, Secret: []byte(*secret)}).Sign(req); err != nil {
+		fail(err)
+	}
+	if *verbose {
+		timestamp, nonce := req.Header.Get(hmacauth.HeaderTimestamp), req.Header.Get(hmacauth.HeaderNonce)
+		fmt.Fprintf(os.Stderr, "String to sign:\n%s\n\n", hmacauth.StringToSign(req.Method, req.URL.RequestURI(), timestamp, nonce, []byte(*data)))
+		for _, h := range []string{hmacauth.HeaderKeyID, hmacauth.HeaderTimestamp, hmacauth.HeaderNonce, hmacauth.HeaderSignature} {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", h, req.Header.Get(h))
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+
+	for range *repeat {
+		if req.GetBody != nil {
+			req.Body, _ = req.GetBody()
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fail(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		fmt.Printf("%s\n%s\n", resp.Status, body)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "‼️", err)
+	os.Exit(1)
+}
@@ -0,0 +1,240 @@
+// Package fixtures serves mock routes declared in JSON or YAML files, reloaded when they change:
+//
+//	routes:
+//	  - name: get-user
+//	    method: GET
+//	    path: /users/{id}            # net/http patterns, {rest...} matches the remaining path
+//	    match:                       # optional, "*" only requires the header or parameter
+//	      headers: {Authorization: "*"}
+//	      query: {expand: profile}
+//	    response:
+//	      status: 200
+//	      headers: {Content-Type: application/json}
+//	      body: '{"id": "{{.Path.id}}", "name": "User {{.Path.id}}"}'   # a text/template, or bodyFile
+//	      delay: 300ms
+//
+// Routes of the same method and path are tried in order, files in lexical order, so a route without
+// match conditions after the others is the default one. Files and directories starting with "_" aren't
+// fixtures, they hold the body files, e.g. bodyFile: _bodies/user.json.
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is a fixture file.
+type File struct {
+	Routes []*Route `yaml:"routes"`
+}
+
+// Route is a mock route.
+type Route struct {
+	Name string `yaml:"name,omitempty"`
+	// Method is any method when empty
+	Method   string   `yaml:"method,omitempty"`
+	Path     string   `yaml:"path"`
+	Match    Match    `yaml:"match,omitempty"`
+	Response Response `yaml:"response"`
+
+	file   string
+	params []string
+	body   *template.Template
+	// jsonBody is the body when it's an object or array
+	jsonBody []byte
+}
+
+// Match are conditions on the request, besides its method and path.
+type Match struct {
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Query   map[string]string `yaml:"query,omitempty"`
+}
+
+// Response is the response of a route.
+type Response struct {
+	// Status is 200 when zero
+	Status  int               `yaml:"status,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Body is a template when it's a string, an object or array is served as JSON as is
+	Body any `yaml:"body,omitempty"`
+	// BodyFile is a template file, relative to the fixture file
+	BodyFile string   `yaml:"bodyFile,omitempty"`
+	Delay    Duration `yaml:"delay,omitempty"`
+}
+
+// Duration is a time.Duration written like "300ms".
+type Duration time.Duration
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// pattern is the net/http pattern of the route.
+func (route *Route) pattern() string {
+	if route.Method == "" {
+		return route.Path
+	}
+	return route.Method + " " + route.Path
+}
+
+// ID names the route on logs and the X-Fixture response header.
+func (route *Route) ID() string {
+	if route.Name == "" {
+		return route.file + " " + route.pattern()
+	}
+	return route.file + "#" + route.Name
+}
+
+// matches reports whether the headers and query of r match the route.
+func (route *Route) matches(r *http.Request) bool {
+	for name, want := range route.Match.Headers {
+		if !matchValue(r.Header.Values(name), want) {
+			return false
+		}
+	}
+	query := r.URL.Query()
+	for name, want := range route.Match.Query {
+		if !matchValue(query[name], want) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchValue(values []string, want string) bool {
+	for _, v := range values {
+		if want == "*" || v == want {
+			return true
+		}
+	}
+	return false
+}
+
+var paramPattern = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+var funcs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"now": time.Now,
+}
+
+// compile checks the route and parses its body template.
+func (route *Route) compile(dir string) error {
+	if !strings.HasPrefix(route.Path, "/") {
+		return fmt.Errorf("path %q must start with /", route.Path)
+	}
+	for _, m := range paramPattern.FindAllStringSubmatch(route.Path, -1) {
+		route.params = append(route.params, m[1])
+	}
+	if route.Response.Status == 0 {
+		route.Response.Status = http.StatusOK
+	}
+	if route.Response.Status < 100 || route.Response.Status > 999 {
+		return fmt.Errorf("invalid status %d", route.Response.Status)
+	}
+
+	var text string
+	switch body := route.Response.Body.(type) {
+	case nil:
+	case string:
+		text = body
+	default:
+		// Served as is, {{ }} in JSON strings aren't templates
+		var err error
+		if route.jsonBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+		if _, ok := route.Response.Headers["Content-Type"]; !ok {
+			if route.Response.Headers == nil {
+				route.Response.Headers = map[string]string{}
+			}
+			route.Response.Headers["Content-Type"] = "application/json"
+		}
+	}
+	if route.Response.BodyFile != "" {
+		if route.Response.Body != nil {
+			return errors.New("body and bodyFile are exclusive")
+		}
+		data, err := os.ReadFile(filepath.Join(dir, route.Response.BodyFile))
+		if err != nil {
+			return err
+		}
+		text = string(data)
+	}
+	var err error
+	route.body, err = template.New(route.ID()).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	return err
+}
+
+// Load reads the routes of the .json, .yaml and .yml files of dir and its subdirectories.
+func Load(dir string) ([]*Route, error) {
+	var routes []*Route
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case path != dir && strings.HasPrefix(d.Name(), "_"):
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		case d.IsDir():
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".json", ".yaml", ".yml":
+		default:
+			return nil
+		}
+		fileRoutes, err := loadFile(dir, path)
+		routes = append(routes, fileRoutes...)
+		return err
+	})
+	return routes, err
+}
+
+func loadFile(root, path string) ([]*Route, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is YAML too
+	var file File
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	name, _ := filepath.Rel(root, path)
+	for i, route := range file.Routes {
+		route.file = filepath.ToSlash(name)
+		if err := route.compile(filepath.Dir(path)); err != nil {
+			return nil, fmt.Errorf("%s: route %d: %w", path, i, err)
+		}
+	}
+	return file.Routes, nil
+}
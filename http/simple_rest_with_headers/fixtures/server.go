@@ -0,0 +1,221 @@
+package fixtures
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	// Local
+	"local/shared/problem"
+)
+
+// HeaderFixture names the route serving a response.
+const HeaderFixture = "X-Fixture"
+
+// Server serves the routes of a fixture directory.
+type Server struct {
+	dir string
+
+	mux atomic.Pointer[http.ServeMux]
+	// reloadMu serializes reloads
+	reloadMu sync.Mutex
+	stamps   map[string]fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New loads the routes of dir.
+func New(dir string) (*Server, error) {
+	s := &Server{dir: dir}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the fixtures again, keeping the previous routes when they're invalid.
+func (s *Server) Reload() (int, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	stamps, err := s.scan()
+	if err != nil {
+		return 0, err
+	}
+	// Even when invalid, so Watch waits for the next edit
+	s.stamps = stamps
+	routes, err := Load(s.dir)
+	if err != nil {
+		return 0, err
+	}
+	mux, err := newMux(routes)
+	if err != nil {
+		return 0, err
+	}
+	s.mux.Store(mux)
+	return len(routes), nil
+}
+
+// scan returns the stamps of every file of the directory, body files included.
+func (s *Server) scan() (map[string]fileStamp, error) {
+	stamps := map[string]fileStamp{}
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stamps[path] = fileStamp{info.ModTime(), info.Size()}
+		return nil
+	})
+	return stamps, err
+}
+
+// Watch reloads the fixtures every interval when a file changed, until ctx is done.
+func (s *Server) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stamps, err := s.scan()
+		s.reloadMu.Lock()
+		changed := err == nil && !maps.Equal(stamps, s.stamps)
+		s.reloadMu.Unlock()
+		if !changed {
+			continue
+		}
+		n, err := s.Reload()
+		if err != nil {
+			slog.Error("Keeping the previous fixtures", "error", err)
+			continue
+		}
+		slog.Info("🧩 Fixtures reloaded", "dir", s.dir, "routes", n)
+	}
+}
+
+// newMux registers the routes by pattern, in order.
+func newMux(routes []*Route) (mux *http.ServeMux, err error) {
+	var patterns []string
+	byPattern := map[string][]*Route{}
+	for _, route := range routes {
+		p := route.pattern()
+		if _, ok := byPattern[p]; !ok {
+			patterns = append(patterns, p)
+		}
+		byPattern[p] = append(byPattern[p], route)
+	}
+
+	mux = http.NewServeMux()
+	// ServeMux panics on invalid and conflicting patterns
+	var pattern string
+	defer func() {
+		if r := recover(); r != nil {
+			mux, err = nil, fmt.Errorf("%s: %v", byPattern[pattern][0].ID(), r)
+		}
+	}()
+	for _, pattern = range patterns {
+		mux.Handle(pattern, candidates(byPattern[pattern]))
+	}
+	return mux, nil
+}
+
+// ServeHTTP serves the first matching route, or a 404 problem.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mux := s.mux.Load()
+	if _, pattern := mux.Handler(r); pattern == "" {
+		problem.Write(w, r, problem.New(http.StatusNotFound, problem.TypeBlank,
+			fmt.Sprintf("no fixture for %s %s", r.Method, r.URL.Path)))
+		return
+	}
+	mux.ServeHTTP(w, r)
+}
+
+// candidates serves the first of routes matching the request.
+func candidates(routes []*Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range routes {
+			if route.matches(r) {
+				route.serve(w, r)
+				return
+			}
+		}
+		ids := make([]string, len(routes))
+		for i, route := range routes {
+			ids[i] = route.ID()
+		}
+		problem.Write(w, r, problem.New(http.StatusNotFound, problem.TypeBlank,
+			fmt.Sprintf("no fixture of %s matches the headers or query", r.Pattern)).With("fixtures", ids))
+	})
+}
+
+// templateData is the data of body templates:
+//
+//	{{.Method}} {{.Path.id}} {{.Query.Get "page"}} {{.Header.Get "X-Request-ID"}} {{.Body}} {{.JSON.amount}}
+type templateData struct {
+	Method string
+	Path   map[string]string
+	Query  url.Values
+	Header http.Header
+	Body   string
+	// JSON is the decoded body, nil when it's not JSON
+	JSON any
+}
+
+func (route *Route) serve(w http.ResponseWriter, r *http.Request) {
+	body := route.jsonBody
+	if body == nil {
+		data := templateData{Method: r.Method, Path: map[string]string{}, Query: r.URL.Query(), Header: r.Header}
+		for _, name := range route.params {
+			data.Path[name] = r.PathValue(name)
+		}
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.Write(w, r, problem.InvalidBody(err))
+			return
+		}
+		data.Body = string(raw)
+		json.Unmarshal(raw, &data.JSON)
+
+		var buf bytes.Buffer
+		if err := route.body.Execute(&buf, data); err != nil {
+			slog.ErrorContext(r.Context(), "Fixture template failed", "fixture", route.ID(), "error", err)
+			problem.Write(w, r, problem.Internal())
+			return
+		}
+		body = buf.Bytes()
+	}
+
+	if delay := time.Duration(route.Response.Delay); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	for name, value := range route.Response.Headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(HeaderFixture, route.ID())
+	w.WriteHeader(route.Response.Status)
+	w.Write(body)
+}
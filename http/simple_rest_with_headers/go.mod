@@ -0,0 +1,9 @@
+module simple_rest_with_headers
+
+go 1.24.3
+
+require local/shared v0.0.0-00010101000000-000000000000
+
+require gopkg.in/yaml.v3 v3.0.1
+
+replace local/shared => ../../shared
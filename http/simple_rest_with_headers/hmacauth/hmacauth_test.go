@@ -0,0 +1,170 @@
+package hmacauth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	// Local
+	"local/shared"
+)
+
+var testSecret = []byte("test-secret")
+
+func testVerifier(opts ...Option) *Verifier {
+	return NewVerifier(map[string]shared.Secret{"android-dev": shared.NewSecret(string(testSecret))}, opts...)
+}
+
+// signedRequest returns a request signed like a client would, with the given timestamp and nonce.
+func signedRequest(method, uri, body string, signedAt time.Time, nonce string) *http.Request {
+	r := httptest.NewRequest(method, uri, strings.NewReader(body))
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	r.Header.Set(HeaderKeyID, "android-dev")
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, Signature(testSecret, StringToSign(method, r.URL.RequestURI(), timestamp, nonce, []byte(body))))
+	return r
+}
+
+func TestStringToSign(t *testing.T) {
+	got := StringToSign("POST", "/payments?currency=EUR", "1735689600", "3q2-7wAAAAAN0X8Ad0qZ3A", nil)
+	want := "POST\n/payments?currency=EUR\n1735689600\n3q2-7wAAAAAN0X8Ad0qZ3A\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if got != want {
+		t.Errorf("StringToSign() = %q, want %q", got, want)
+	}
+
+	got = StringToSign("GET", "/users/42", "1", "nonce", []byte("abc"))
+	want = "GET\n/users/42\n1\nnonce\nba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got != want {
+		t.Errorf("StringToSign() = %q, want %q", got, want)
+	}
+
+	// HMAC-SHA256 test case 2 of RFC 4231
+	if got, want := Signature([]byte("Jefe"), "what do ya want for nothing?"), "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"; got != want {
+		t.Errorf("Signature() = %s, want %s", got, want)
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	r := httptest.NewRequest("POST", "/payments?currency=EUR", strings.NewReader(`{"amount": 10}`))
+	if err := (Signer{KeyID: "android-dev", Secret: testSecret}).Sign(r); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	keyID, err := testVerifier().Verify(r)
+	if err != nil || keyID != "android-dev" {
+		t.Fatalf("Verify() = %q, %v, want android-dev", keyID, err)
+	}
+	// The body is still there for the handler
+	if body, _ := io.ReadAll(r.Body); string(body) != `{"amount": 10}` {
+		t.Errorf("body after Verify() = %q", body)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		modify func(r *http.Request)
+		want   error
+	}{
+		{"missing signature", func(r *http.Request) { r.Header.Del(HeaderSignature) }, ErrMissing},
+		{"missing key id", func(r *http.Request) { r.Header.Del(HeaderKeyID) }, ErrMissing},
+		{"unknown key", func(r *http.Request) { r.Header.Set(HeaderKeyID, "other") }, ErrUnknownKey},
+		{"timestamp not a number", func(r *http.Request) { r.Header.Set(HeaderTimestamp, "yesterday") }, ErrTimestamp},
+		{"short nonce", func(r *http.Request) { r.Header.Set(HeaderNonce, "abc") }, ErrNonce},
+		{"nonce with invalid chars", func(r *http.Request) { r.Header.Set(HeaderNonce, "nonce-of-16-chars+") }, ErrNonce},
+		{"signature not hex", func(r *http.Request) { r.Header.Set(HeaderSignature, "zz") }, ErrSignature},
+		{"other method", func(r *http.Request) { r.Method = "PUT" }, ErrSignature},
+		{"other query", func(r *http.Request) { r.URL.RawQuery = "currency=USD" }, ErrSignature},
+		{"other body", func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader(`{"amount": 1000}`)) }, ErrSignature},
+		{"other timestamp", func(r *http.Request) {
+			r.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix()+1, 10))
+		}, ErrSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := signedRequest("POST", "/payments?currency=EUR", `{"amount": 10}`, now, NewNonce())
+			tt.modify(r)
+			if _, err := testVerifier().Verify(r); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTimestampWindow(t *testing.T) {
+	window := time.Minute
+	tests := []struct {
+		name   string
+		offset time.Duration
+		want   error
+	}{
+		{"now", 0, nil},
+		{"in the past, within the window", -window + 5*time.Second, nil},
+		{"in the future, within the window", window - 5*time.Second, nil},
+		{"too old", -window - 5*time.Second, ErrTimestamp},
+		{"too far in the future", window + 5*time.Second, ErrTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := signedRequest("GET", "/users/42", "", time.Now().Add(tt.offset), NewNonce())
+			if _, err := testVerifier(WithWindow(window)).Verify(r); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	v := testVerifier()
+	nonce, now := NewNonce(), time.Now()
+	if _, err := v.Verify(signedRequest("GET", "/users/42", "", now, nonce)); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if _, err := v.Verify(signedRequest("GET", "/users/42", "", now, nonce)); !errors.Is(err, ErrReplay) {
+		t.Errorf("Verify() of a replay error = %v, want %v", err, ErrReplay)
+	}
+	// The nonce is spent whatever the request it signs
+	if _, err := v.Verify(signedRequest("GET", "/users/7", "", now, nonce)); !errors.Is(err, ErrReplay) {
+		t.Errorf("Verify() of another request with the nonce error = %v, want %v", err, ErrReplay)
+	}
+}
+
+func TestInvalidSignatureKeepsNonce(t *testing.T) {
+	v := testVerifier()
+	nonce, now := NewNonce(), time.Now()
+
+	forged := signedRequest("GET", "/users/42", "", now, nonce)
+	forged.Header.Set(HeaderSignature, Signature([]byte("wrong secret"), "anything"))
+	if _, err := v.Verify(forged); !errors.Is(err, ErrSignature) {
+		t.Fatalf("Verify() of a forged request error = %v, want %v", err, ErrSignature)
+	}
+	// An attacker can't use up the nonce of a legit client
+	if _, err := v.Verify(signedRequest("GET", "/users/42", "", now, nonce)); err != nil {
+		t.Errorf("Verify() after a forged request error = %v", err)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	handler := testVerifier().Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, _ := KeyIDFromContext(r.Context())
+		io.WriteString(w, keyID)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest("GET", "/users/42", "", time.Now(), NewNonce()))
+	if w.Code != http.StatusOK || w.Body.String() != "android-dev" {
+		t.Errorf("signed request = %d %q, want 200 android-dev", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/users/42", nil))
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "HMAC-SHA256") {
+		t.Errorf("unsigned request = %d, WWW-Authenticate %q, want 401 HMAC-SHA256", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
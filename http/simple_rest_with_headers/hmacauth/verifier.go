@@ -0,0 +1,205 @@
+package hmacauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	// Local
+	"local/shared"
+	"local/shared/problem"
+)
+
+// DefaultWindow is how far the timestamp of a request may be from the server clock.
+const DefaultWindow = 5 * time.Minute
+
+// Verification errors, all of them are answered with a 401.
+var (
+	ErrMissing    = errors.New("missing signature headers")
+	ErrUnknownKey = errors.New("unknown signing key")
+	ErrTimestamp  = errors.New("timestamp outside the allowed window")
+	ErrNonce      = errors.New("invalid nonce")
+	ErrSignature  = errors.New("invalid signature")
+	ErrReplay     = errors.New("nonce already used")
+)
+
+var nonceFormat = regexp.MustCompile(`^[A-Za-z0-9_-]{16,64}$`)
+
+// Key is an entry of the key file:
+//
+//	{"keys": [{"id": "android-dev", "secret": "..."}]}
+type Key struct {
+	ID     string        `json:"id"`
+	Secret shared.Secret `json:"secret"`
+}
+
+// LoadKeys reads the key file at path.
+func LoadKeys(path string) (map[string]shared.Secret, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Keys []Key `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	keys := map[string]shared.Secret{}
+	for i, key := range file.Keys {
+		switch {
+		case key.ID == "":
+			return nil, fmt.Errorf("%s: key %d: missing id", path, i)
+		case key.Secret.IsZero():
+			return nil, fmt.Errorf("%s: key %q: missing secret", path, key.ID)
+		}
+		if _, ok := keys[key.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate key %q", path, key.ID)
+		}
+		keys[key.ID] = key.Secret
+	}
+	return keys, nil
+}
+
+// Option configures a Verifier.
+type Option func(*Verifier)
+
+// WithWindow sets how far timestamps may be from the server clock, DefaultWindow by default.
+func WithWindow(window time.Duration) Option {
+	return func(v *Verifier) {
+		v.window = window
+	}
+}
+
+// Verifier checks the signature of requests.
+type Verifier struct {
+	keys   map[string]shared.Secret
+	window time.Duration
+
+	mu     sync.Mutex
+	nonces map[string]time.Time // key ID and nonce, to when they can be forgotten
+	pruned time.Time
+}
+
+// NewVerifier creates a Verifier of the keys by ID.
+func NewVerifier(keys map[string]shared.Secret, opts ...Option) *Verifier {
+	v := &Verifier{keys: keys, window: DefaultWindow, nonces: map[string]time.Time{}}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Verify checks the signature of r and returns its key ID. The body is read and replaced,
+// errors other than the verification ones are from reading it.
+func (v *Verifier) Verify(r *http.Request) (string, error) {
+	keyID, timestamp := r.Header.Get(HeaderKeyID), r.Header.Get(HeaderTimestamp)
+	nonce, signature := r.Header.Get(HeaderNonce), r.Header.Get(HeaderSignature)
+	if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return "", ErrMissing
+	}
+
+	now := time.Now()
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", ErrTimestamp
+	}
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-v.window)) || signedAt.After(now.Add(v.window)) {
+		return "", ErrTimestamp
+	}
+	if !nonceFormat.MatchString(nonce) {
+		return "", ErrNonce
+	}
+	secret, ok := v.keys[keyID]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	expected := mac([]byte(secret.Reveal()), StringToSign(r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, expected) {
+		return "", ErrSignature
+	}
+
+	// Only after the signature is valid, so unsigned requests can't use up nonces.
+	// A nonce is kept until its timestamp leaves the window, the request is rejected past that anyway.
+	if !v.useNonce(keyID+":"+nonce, signedAt.Add(v.window), now) {
+		return "", ErrReplay
+	}
+	return keyID, nil
+}
+
+// useNonce records nonce until expires, and reports whether it wasn't used yet.
+func (v *Verifier) useNonce(nonce string, expires, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if now.Sub(v.pruned) > time.Second {
+		for n, exp := range v.nonces {
+			if now.After(exp) {
+				delete(v.nonces, n)
+			}
+		}
+		v.pruned = now
+	}
+	if _, used := v.nonces[nonce]; used {
+		return false
+	}
+	v.nonces[nonce] = expires
+	return true
+}
+
+type keyIDContext struct{}
+
+// KeyIDFromContext returns the key ID verified by Require.
+func KeyIDFromContext(ctx context.Context) (string, bool) {
+	keyID, ok := ctx.Value(keyIDContext{}).(string)
+	return keyID, ok
+}
+
+// Require answers 401 to requests without a valid signature:
+//
+//	mux.Handle("POST /payments", verifier.Require(http.HandlerFunc(paymentsHandler)))
+func (v *Verifier) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, err := v.Verify(r)
+		if err != nil {
+			if !isVerificationError(err) {
+				problem.Write(w, r, problem.InvalidBody(err))
+				return
+			}
+			slog.WarnContext(r.Context(), "Request signature rejected", "key_id", r.Header.Get(HeaderKeyID), "error", err)
+			w.Header().Set("WWW-Authenticate", `HMAC-SHA256 headers="`+HeaderKeyID+" "+HeaderTimestamp+" "+HeaderNonce+" "+HeaderSignature+`"`)
+			problem.Write(w, r, problem.Unauthorized(err.Error()))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyIDContext{}, keyID)))
+	})
+}
+
+func isVerificationError(err error) bool {
+	for _, e := range []error{ErrMissing, ErrUnknownKey, ErrTimestamp, ErrNonce, ErrSignature, ErrReplay} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package jwtauth
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Signing algorithms.
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	HS256 = "HS256"
+)
+
+// JWK is an RFC 7517 JSON Web Key of one of the algorithms, RSA, P-256 or a shared secret.
+// Private keys also have the private members, see Public.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use,omitempty"`
+
+	// RSA
+	N  string `json:"n,omitempty"`
+	E  string `json:"e,omitempty"`
+	D  string `json:"d,omitempty"` // and EC
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+
+	// Shared secret, HS256 keys are private by nature
+	K string `json:"k,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, the content of a key file.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ReadJWKS reads the key set file at path.
+func ReadJWKS(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &set, nil
+}
+
+// Key returns the key of kid, or the only key of alg when kid is empty.
+func (s *JWKS) Key(kid, alg string) (JWK, error) {
+	var found []JWK
+	for _, k := range s.Keys {
+		if (kid == "" || k.Kid == kid) && (alg == "" || k.Alg == alg) {
+			found = append(found, k)
+		}
+	}
+	switch {
+	case len(found) == 0:
+		return JWK{}, fmt.Errorf("no key with kid %q and alg %q", kid, alg)
+	case len(found) > 1:
+		return JWK{}, fmt.Errorf("several keys with kid %q and alg %q", kid, alg)
+	}
+	return found[0], nil
+}
+
+// Public returns the key without its private members, false for shared secrets.
+func (k JWK) Public() (JWK, bool) {
+	if k.Kty == "oct" {
+		return JWK{}, false
+	}
+	return JWK{Kty: k.Kty, Kid: k.Kid, Alg: k.Alg, Use: k.Use, N: k.N, E: k.E, Crv: k.Crv, X: k.X, Y: k.Y}, true
+}
+
+// verifyKey returns the *rsa.PublicKey, *ecdsa.PublicKey or []byte secret checking signatures of k.
+func (k JWK) verifyKey() (any, error) {
+	switch {
+	case k.Alg == RS256 && k.Kty == "RSA":
+		n, err1 := decodeInt(k.N)
+		e, err2 := decodeInt(k.E)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 || n.BitLen() < 2048 {
+			return nil, errors.New("invalid RSA key, it must be 2048 bits or more")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case k.Alg == ES256 && k.Kty == "EC" && k.Crv == "P-256":
+		x, err1 := decodeFixed(k.X, 32)
+		y, err2 := decodeFixed(k.Y, 32)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, err
+		}
+		// ecdh checks the point is on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case k.Alg == HS256 && k.Kty == "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) < 32 {
+			return nil, errors.New("HS256 secret must be 32 bytes or more")
+		}
+		return secret, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q with alg %q", k.Kty, k.Alg)
+}
+
+// signKey returns the *rsa.PrivateKey, *ecdsa.PrivateKey or []byte secret signing with k.
+func (k JWK) signKey() (any, error) {
+	public, err := k.verifyKey()
+	if err != nil {
+		return nil, err
+	}
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		d, err1 := decodeInt(k.D)
+		p, err2 := decodeInt(k.P)
+		q, err3 := decodeInt(k.Q)
+		if err := errors.Join(err1, err2, err3); err != nil {
+			return nil, fmt.Errorf("kid %q is not a private key: %w", k.Kid, err)
+		}
+		key := &rsa.PrivateKey{PublicKey: *public, D: d, Primes: []*big.Int{p, q}}
+		if err := key.Validate(); err != nil {
+			return nil, err
+		}
+		key.Precompute()
+		return key, nil
+	case *ecdsa.PublicKey:
+		d, err := decodeInt(k.D)
+		if err != nil {
+			return nil, fmt.Errorf("kid %q is not a private key: %w", k.Kid, err)
+		}
+		return &ecdsa.PrivateKey{PublicKey: *public, D: d}, nil
+	}
+	return public, nil
+}
+
+// GenerateJWK returns a new private key of alg.
+func GenerateJWK(alg, kid string) (JWK, error) {
+	k := JWK{Kid: kid, Alg: alg, Use: "sig"}
+	switch alg {
+	case RS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return JWK{}, err
+		}
+		k.Kty = "RSA"
+		k.N, k.E, k.D = encodeInt(key.N), encodeInt(big.NewInt(int64(key.E))), encodeInt(key.D)
+		k.P, k.Q = encodeInt(key.Primes[0]), encodeInt(key.Primes[1])
+		k.DP, k.DQ, k.QI = encodeInt(key.Precomputed.Dp), encodeInt(key.Precomputed.Dq), encodeInt(key.Precomputed.Qinv)
+	case ES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return JWK{}, err
+		}
+		k.Kty, k.Crv = "EC", "P-256"
+		k.X, k.Y, k.D = encodeFixed(key.X, 32), encodeFixed(key.Y, 32), encodeFixed(key.D, 32)
+	case HS256:
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		k.Kty, k.K = "oct", base64.RawURLEncoding.EncodeToString(secret)
+	default:
+		return JWK{}, fmt.Errorf("unsupported alg %q", alg)
+	}
+	return k, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid base64url integer %q", s)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func decodeFixed(s string, size int) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) != size {
+		return nil, fmt.Errorf("invalid base64url coordinate %q", s)
+	}
+	return b, nil
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func encodeFixed(i *big.Int, size int) string {
+	return base64.RawURLEncoding.EncodeToString(i.FillBytes(make([]byte, size)))
+}
@@ -0,0 +1,199 @@
+// Package jwtauth validates RS256, ES256 and HS256 JWT bearer tokens against a local JWKS file,
+// checking exp, nbf, iss and aud, and maps their scope claims to the scopes required by routes.
+//
+// Tokens are minted offline by cmd/jwt, including expired and wrongly signed ones.
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Validation errors, all of them are answered with a 401.
+var (
+	ErrMissing   = errors.New("missing bearer token")
+	ErrMalformed = errors.New("malformed token")
+	ErrKey       = errors.New("unknown signing key")
+	ErrSignature = errors.New("invalid signature")
+	ErrExpired   = errors.New("token expired")
+	ErrNotYet    = errors.New("token not valid yet")
+	ErrIssuer    = errors.New("invalid issuer")
+	ErrAudience  = errors.New("invalid audience")
+)
+
+// NumericDate is a JWT time, in Unix seconds.
+type NumericDate int64
+
+// NewNumericDate returns the NumericDate of t.
+func NewNumericDate(t time.Time) NumericDate {
+	return NumericDate(t.Unix())
+}
+
+// Time returns the time of d.
+func (d NumericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
+
+// UnmarshalJSON accepts fractional seconds too.
+func (d *NumericDate) UnmarshalJSON(data []byte) error {
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	*d = NumericDate(math.Floor(f))
+	return nil
+}
+
+// StringList is a JSON string or array of strings, as aud and scp claims may be either.
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = StringList{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+func (l StringList) MarshalJSON() ([]byte, error) {
+	if len(l) == 1 {
+		return json.Marshal(l[0])
+	}
+	return json.Marshal([]string(l))
+}
+
+// Claims are the claims of a token.
+type Claims struct {
+	Issuer    string      `json:"iss,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Audience  StringList  `json:"aud,omitempty"`
+	ExpiresAt NumericDate `json:"exp,omitempty"`
+	NotBefore NumericDate `json:"nbf,omitempty"`
+	IssuedAt  NumericDate `json:"iat,omitempty"`
+	ID        string      `json:"jti,omitempty"`
+	// Scope is space separated (RFC 8693), Scp is the array form used by some providers
+	Scope string     `json:"scope,omitempty"`
+	Scp   StringList `json:"scp,omitempty"`
+}
+
+// Scopes returns the scopes of the scope and scp claims.
+func (c *Claims) Scopes() []string {
+	return append(strings.Fields(c.Scope), c.Scp...)
+}
+
+// HasScope reports whether the token grants scope, "*" grants every scope.
+func (c *Claims) HasScope(scope string) bool {
+	scopes := c.Scopes()
+	return slices.Contains(scopes, scope) || slices.Contains(scopes, "*")
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Sign returns the token of claims, signed with the private key k.
+func Sign(claims *Claims, k JWK) (string, error) {
+	key, err := k.signKey()
+	if err != nil {
+		return "", err
+	}
+	h, _ := json.Marshal(header{Alg: k.Alg, Kid: k.Kid, Typ: "JWT"})
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := encode(h) + "." + encode(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		if r, s, err = ecdsa.Sign(rand.Reader, key, digest[:]); err == nil {
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + encode(sig), nil
+}
+
+// verify checks the signature of token with the key of its kid in keys, and returns its claims.
+// The alg of the token must be the alg of the key, so an RSA public key can't be used as an HS256 secret.
+func verify(token string, keys map[string]verifyKey) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return nil, ErrMalformed
+	}
+	key, ok := keys[h.Kid]
+	if !ok || key.alg != h.Alg {
+		return nil, fmt.Errorf("%w: kid %q, alg %q", ErrKey, h.Kid, h.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	signed := parts[0] + "." + parts[1]
+	digest := sha256.Sum256([]byte(signed))
+	var valid bool
+	switch key := key.key.(type) {
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		valid = len(sig) == 64 &&
+			ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		valid = hmac.Equal(sig, mac.Sum(nil))
+	}
+	if !valid {
+		return nil, ErrSignature
+	}
+
+	var claims Claims
+	if err := decodeJSON(parts[1], &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	return &claims, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeJSON(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
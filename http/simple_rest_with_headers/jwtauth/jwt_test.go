@@ -0,0 +1,274 @@
+package jwtauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testKeys are generated once, RSA keys are slow to generate.
+var testKeys = sync.OnceValue(func() map[string]JWK {
+	keys := map[string]JWK{}
+	for _, alg := range []string{RS256, ES256, HS256} {
+		k, err := GenerateJWK(alg, strings.ToLower(alg))
+		if err != nil {
+			panic(err)
+		}
+		keys[alg] = k
+	}
+	return keys
+})
+
+func testValidator(t *testing.T, opts ...Option) *Validator {
+	t.Helper()
+	set := &JWKS{}
+	for _, k := range testKeys() {
+		set.Keys = append(set.Keys, k)
+	}
+	v, err := NewValidator(set, opts...)
+	if err != nil {
+		t.Fatalf("NewValidator() error = %v", err)
+	}
+	return v
+}
+
+func validClaims() *Claims {
+	now := time.Now()
+	return &Claims{
+		Issuer:    "mock-rest",
+		Subject:   "42",
+		Audience:  StringList{"android-app"},
+		ExpiresAt: NewNumericDate(now.Add(time.Hour)),
+		IssuedAt:  NewNumericDate(now),
+		Scope:     "profile:read",
+	}
+}
+
+func sign(t *testing.T, claims *Claims, k JWK) string {
+	t.Helper()
+	token, err := Sign(claims, k)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	return token
+}
+
+// forge returns a token of header and claims, with the signature of signature.
+func forge(h header, claims *Claims, signature func(signed string) []byte) string {
+	hj, _ := json.Marshal(h)
+	cj, _ := json.Marshal(claims)
+	signed := encode(hj) + "." + encode(cj)
+	return signed + "." + encode(signature(signed))
+}
+
+func hs256(secret []byte) func(string) []byte {
+	return func(signed string) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		return mac.Sum(nil)
+	}
+}
+
+func TestValidateAlgorithms(t *testing.T) {
+	v := testValidator(t)
+	for alg, k := range testKeys() {
+		t.Run(alg, func(t *testing.T) {
+			claims, err := v.Validate(sign(t, validClaims(), k))
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if claims.Subject != "42" || !claims.HasScope("profile:read") {
+				t.Errorf("Validate() claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestValidateKeyBinding(t *testing.T) {
+	keys := testKeys()
+	rsaPublic, _ := keys[RS256].Public()
+	rsaPublicJSON, _ := json.Marshal(rsaPublic)
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		want  error
+	}{
+		{"alg none", func(t *testing.T) string {
+			return forge(header{Alg: "none", Kid: "rs256"}, validClaims(), func(string) []byte { return nil })
+		}, ErrKey},
+		{"alg none without kid", func(t *testing.T) string {
+			return forge(header{Alg: "none"}, validClaims(), func(string) []byte { return nil })
+		}, ErrKey},
+		{"HS256 signed with the RSA public key", func(t *testing.T) string {
+			return forge(header{Alg: HS256, Kid: "rs256"}, validClaims(), hs256(rsaPublicJSON))
+		}, ErrKey},
+		{"HS256 signed with the RSA modulus", func(t *testing.T) string {
+			n, _ := decodeInt(rsaPublic.N)
+			return forge(header{Alg: HS256, Kid: "rs256"}, validClaims(), hs256(n.Bytes()))
+		}, ErrKey},
+		{"alg of another key", func(t *testing.T) string {
+			// Signed by the ES256 key, but claiming to be of the RS256 one
+			token := sign(t, validClaims(), keys[ES256])
+			_, rest, _ := strings.Cut(token, ".")
+			h, _ := json.Marshal(header{Alg: ES256, Kid: "rs256"})
+			return encode(h) + "." + rest
+		}, ErrKey},
+		{"unknown kid", func(t *testing.T) string {
+			other := keys[HS256]
+			other.Kid = "other"
+			return sign(t, validClaims(), other)
+		}, ErrKey},
+		{"signed by another key of the alg", func(t *testing.T) string {
+			other, _ := GenerateJWK(HS256, "hs256")
+			return sign(t, validClaims(), other)
+		}, ErrSignature},
+		{"tampered claims", func(t *testing.T) string {
+			parts := strings.Split(sign(t, validClaims(), keys[ES256]), ".")
+			admin := validClaims()
+			admin.Scope = "*"
+			c, _ := json.Marshal(admin)
+			return parts[0] + "." + encode(c) + "." + parts[2]
+		}, ErrSignature},
+		{"two parts", func(t *testing.T) string { return "abc.def" }, ErrMalformed},
+		{"header not base64", func(t *testing.T) string { return "%%%.def.ghi" }, ErrMalformed},
+	}
+	v := testValidator(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := v.Validate(tt.token(t)); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTimes(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		modify func(c *Claims)
+		want   error
+	}{
+		{"no exp", func(c *Claims) { c.ExpiresAt = 0 }, ErrExpired},
+		{"expired within the leeway", func(c *Claims) { c.ExpiresAt = NewNumericDate(now.Add(-10 * time.Second)) }, nil},
+		{"expired", func(c *Claims) { c.ExpiresAt = NewNumericDate(now.Add(-time.Minute)) }, ErrExpired},
+		{"nbf in the past", func(c *Claims) { c.NotBefore = NewNumericDate(now.Add(-time.Minute)) }, nil},
+		{"nbf within the leeway", func(c *Claims) { c.NotBefore = NewNumericDate(now.Add(10 * time.Second)) }, nil},
+		{"not valid yet", func(c *Claims) { c.NotBefore = NewNumericDate(now.Add(time.Minute)) }, ErrNotYet},
+	}
+	v := testValidator(t, WithLeeway(30*time.Second))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+			if _, err := v.Validate(sign(t, claims, testKeys()[HS256])); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateIssuerAndAudience(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Claims)
+		want   error
+	}{
+		{"valid", func(c *Claims) {}, nil},
+		{"one of several audiences", func(c *Claims) { c.Audience = StringList{"web", "android-app"} }, nil},
+		{"other audience", func(c *Claims) { c.Audience = StringList{"web"} }, ErrAudience},
+		{"no audience", func(c *Claims) { c.Audience = nil }, ErrAudience},
+		{"other issuer", func(c *Claims) { c.Issuer = "evil" }, ErrIssuer},
+		{"no issuer", func(c *Claims) { c.Issuer = "" }, ErrIssuer},
+	}
+	v := testValidator(t, WithIssuer("mock-rest"), WithAudience("android-app"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+			if _, err := v.Validate(sign(t, claims, testKeys()[ES256])); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Without WithIssuer and WithAudience, any is accepted
+	claims := validClaims()
+	claims.Issuer, claims.Audience = "other", nil
+	if _, err := testValidator(t).Validate(sign(t, claims, testKeys()[ES256])); err != nil {
+		t.Errorf("Validate() without requirements error = %v", err)
+	}
+}
+
+func TestStringList(t *testing.T) {
+	var claims Claims
+	if err := json.Unmarshal([]byte(`{"aud": "a", "scp": ["b", "c"]}`), &claims); err != nil {
+		t.Fatal(err)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "a" || len(claims.Scp) != 2 {
+		t.Errorf("Unmarshal() = %+v", claims)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	v := testValidator(t)
+	handler := v.Require("profile:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := FromContext(r.Context())
+		w.Write([]byte(claims.Subject))
+	}))
+	noScope := validClaims()
+	noScope.Scope = ""
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		challenge     string
+	}{
+		{"valid", "Bearer " + sign(t, validClaims(), testKeys()[RS256]), http.StatusOK, ""},
+		{"lowercase scheme", "bearer " + sign(t, validClaims(), testKeys()[RS256]), http.StatusOK, ""},
+		{"missing", "", http.StatusUnauthorized, "Bearer"},
+		{"basic", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "Bearer"},
+		{"invalid", "Bearer abc.def.ghi", http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"lacking the scope", "Bearer " + sign(t, noScope, testKeys()[RS256]), http.StatusForbidden, `Bearer error="insufficient_scope", scope="profile:read"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/me", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), tt.challenge) {
+				t.Errorf("status = %d, WWW-Authenticate %q, want %d %q", w.Code, w.Header().Get("WWW-Authenticate"), tt.status, tt.challenge)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != "42" {
+				t.Errorf("body = %q, want the subject", w.Body)
+			}
+		})
+	}
+}
+
+func TestJWKSHandlerHidesSecrets(t *testing.T) {
+	w := httptest.NewRecorder()
+	testValidator(t).JWKSHandler().ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	var set JWKS
+	if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want the RS256 and ES256 ones", len(set.Keys))
+	}
+	for _, k := range set.Keys {
+		if k.D != "" || k.P != "" || k.K != "" {
+			t.Errorf("JWKS key %q has private members", k.Kid)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package jwtauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	// Local
+	"local/shared/logging"
+	"local/shared/problem"
+)
+
+// DefaultLeeway is the clock skew allowed on exp and nbf.
+const DefaultLeeway = 30 * time.Second
+
+type verifyKey struct {
+	alg string
+	key any
+}
+
+// Option configures a Validator.
+type Option func(*Validator)
+
+// WithIssuer requires the iss claim to be issuer.
+func WithIssuer(issuer string) Option {
+	return func(v *Validator) {
+		v.issuer = issuer
+	}
+}
+
+// WithAudience requires the aud claim to contain audience.
+func WithAudience(audience string) Option {
+	return func(v *Validator) {
+		v.audience = audience
+	}
+}
+
+// WithLeeway sets the clock skew allowed on exp and nbf, DefaultLeeway by default.
+func WithLeeway(leeway time.Duration) Option {
+	return func(v *Validator) {
+		v.leeway = leeway
+	}
+}
+
+// Validator validates bearer tokens with the keys of a JWKS.
+type Validator struct {
+	keys     map[string]verifyKey
+	public   JWKS
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+// NewValidator creates a Validator of the keys of set. Tokens must have the kid of a key.
+func NewValidator(set *JWKS, opts ...Option) (*Validator, error) {
+	v := &Validator{keys: map[string]verifyKey{}, public: JWKS{Keys: []JWK{}}, leeway: DefaultLeeway}
+	for _, k := range set.Keys {
+		if k.Kid == "" {
+			return nil, errors.New("JWKS key without kid")
+		}
+		if _, ok := v.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("duplicate JWKS kid %q", k.Kid)
+		}
+		key, err := k.verifyKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS kid %q: %w", k.Kid, err)
+		}
+		v.keys[k.Kid] = verifyKey{alg: k.Alg, key: key}
+		if public, ok := k.Public(); ok {
+			v.public.Keys = append(v.public.Keys, public)
+		}
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v, nil
+}
+
+// Validate checks the signature and the claims of token, and returns its claims.
+func (v *Validator) Validate(token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissing
+	}
+	claims, err := verify(token, v.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch {
+	case claims.ExpiresAt == 0 || now.After(claims.ExpiresAt.Time().Add(v.leeway)):
+		return nil, ErrExpired
+	case claims.NotBefore != 0 && now.Add(v.leeway).Before(claims.NotBefore.Time()):
+		return nil, ErrNotYet
+	case v.issuer != "" && claims.Issuer != v.issuer:
+		return nil, ErrIssuer
+	case v.audience != "" && !slices.Contains(claims.Audience, v.audience):
+		return nil, ErrAudience
+	}
+	return claims, nil
+}
+
+// JWKSHandler serves the public keys, without the HS256 secrets.
+func (v *Validator) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		json.NewEncoder(w).Encode(v.public)
+	})
+}
+
+type claimsContext struct{}
+
+// FromContext returns the claims validated by Require.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContext{}).(*Claims)
+	return claims, ok
+}
+
+// Require answers 401 when the Authorization bearer token is missing or invalid,
+// and 403 when it lacks any of scopes, with RFC 6750 WWW-Authenticate challenges:
+//
+//	mux.Handle("GET /me", validator.Require("profile:read")(http.HandlerFunc(meHandler)))
+func (v *Validator) Require(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token string
+			if scheme, t, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+				token = strings.TrimSpace(t)
+			}
+			claims, err := v.Validate(token)
+			if err != nil {
+				slog.WarnContext(r.Context(), "Bearer token rejected", "error", err)
+				if errors.Is(err, ErrMissing) {
+					w.Header().Set("WWW-Authenticate", `Bearer`)
+				} else {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, err.Error()))
+				}
+				problem.Write(w, r, problem.Unauthorized(err.Error()))
+				return
+			}
+			for _, scope := range scopes {
+				if !claims.HasScope(scope) {
+					slog.WarnContext(r.Context(), "Bearer token lacks scope", logging.UserID(claims.Subject), "scope", scope)
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+					problem.Write(w, r, problem.Forbidden("token lacks the "+scope+" scope").With("required_scope", scope))
+					return
+				}
+			}
+			ctx := logging.With(r.Context(), logging.UserID(claims.Subject))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, claimsContext{}, claims)))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"simple_rest_with_headers/fixtures"
+)
+
+// Fixtures converts recordings to fixture routes of the REST mock, matching the method, path, and the query
+// and headers of rules. Fixtures can't match bodies, so rules.Body is ignored, and they always answer the same:
+// of the recordings of a request, the last one is kept. Recordings with a binary body are skipped,
+// their IDs returned.
+func Fixtures(recordings []*Recording, rules Rules) (file *fixtures.File, skipped []string) {
+	rules.Body = false
+	file = &fixtures.File{}
+	index := map[string]int{}
+	for _, rec := range recordings {
+		if rec.Response.Base64 != nil {
+			skipped = append(skipped, rec.ID)
+			continue
+		}
+		route := fixtureRoute(rec, rules)
+		key := rules.key(&rec.Request)
+		if i, ok := index[key]; ok {
+			file.Routes[i] = route
+			continue
+		}
+		index[key] = len(file.Routes)
+		file.Routes = append(file.Routes, route)
+	}
+	return file, skipped
+}
+
+func fixtureRoute(rec *Recording, rules Rules) *fixtures.Route {
+	route := &fixtures.Route{
+		Name:   rec.ID,
+		Method: rec.Request.Method,
+		Path:   rec.Request.Path,
+	}
+	// A trailing slash is a prefix in net/http patterns
+	if strings.HasSuffix(route.Path, "/") {
+		route.Path += "{$}"
+	}
+	if query, _ := url.ParseQuery(rec.Request.Query); rules.Query && len(query) > 0 {
+		route.Match.Query = map[string]string{}
+		for name, values := range query {
+			route.Match.Query[name] = values[0]
+		}
+	}
+	for _, name := range rules.Headers {
+		if value := rec.Request.Header.Get(name); value != "" {
+			if route.Match.Headers == nil {
+				route.Match.Headers = map[string]string{}
+			}
+			route.Match.Headers[name] = value
+		}
+	}
+
+	route.Response.Status = rec.Response.Status
+	for name, values := range rec.Response.Header {
+		if route.Response.Headers == nil {
+			route.Response.Headers = map[string]string{}
+		}
+		route.Response.Headers[name] = strings.Join(values, ", ")
+	}
+	switch body := rec.Response.Body; {
+	case body.JSON != nil:
+		decoder := json.NewDecoder(bytes.NewReader(body.JSON))
+		decoder.UseNumber()
+		var value any
+		if decoder.Decode(&value) == nil {
+			route.Response.Body = yamlValue(value)
+		}
+		// A JSON string would be read back as a template, and null as no body
+		if _, ok := route.Response.Body.(string); ok || route.Response.Body == nil {
+			route.Response.Body = escapeTemplate(string(body.Bytes()))
+		}
+	case body.Text != "":
+		route.Response.Body = escapeTemplate(body.Text)
+	}
+	return route
+}
+
+// yamlValue converts the json.Number of a decoded JSON value, so integers are written as such.
+func yamlValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = yamlValue(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = yamlValue(value)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// escapeTemplate makes text read back as is by the text/template of fixture bodies.
+func escapeTemplate(text string) string {
+	return strings.ReplaceAll(text, "{{", `{{"{{"}}`)
+}
@@ -0,0 +1,158 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	// Local
+	"local/shared/middleware"
+	"local/shared/problem"
+)
+
+// Option configures a Recorder or a Replayer.
+type Option func(*options)
+
+type options struct {
+	redactor redactor
+	rules    Rules
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		redactor: redactor{headers: DefaultRedactedHeaders, fields: DefaultRedactedFields},
+		rules:    DefaultRules,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithRedactedHeaders redacts headers besides DefaultRedactedHeaders.
+func WithRedactedHeaders(headers ...string) Option {
+	return func(o *options) {
+		o.redactor.headers = append(o.redactor.headers, headers...)
+	}
+}
+
+// WithRedactedFields redacts JSON, form and query fields besides DefaultRedactedFields.
+func WithRedactedFields(fields ...string) Option {
+	return func(o *options) {
+		o.redactor.fields = append(o.redactor.fields, fields...)
+	}
+}
+
+// WithRules sets how a Replayer matches requests to recordings, DefaultRules by default.
+func WithRules(rules Rules) Option {
+	return func(o *options) {
+		o.rules = rules
+	}
+}
+
+// perResponseHeaders aren't recorded, they're set for each response
+var perResponseHeaders = []string{"Content-Length", "Date", middleware.RequestIDHeader}
+
+// Recorder forwards requests to an upstream and records them.
+type Recorder struct {
+	upstream *url.URL
+	dir      string
+	opts     options
+	proxy    *httputil.ReverseProxy
+
+	mu  sync.Mutex
+	seq int
+}
+
+type recordingContext struct{}
+
+// NewRecorder creates a Recorder of upstream, saving the recordings on dir after the ones it has.
+func NewRecorder(upstream *url.URL, dir string, opts ...Option) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	rec := &Recorder{upstream: upstream, dir: dir, opts: newOptions(opts)}
+	for _, file := range existing {
+		var seq int
+		if _, err := fmt.Sscanf(filepath.Base(file), "%d_", &seq); err == nil {
+			rec.seq = max(rec.seq, seq)
+		}
+	}
+	rec.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+			// Uncompressed bodies on the recordings, the transport still asks for gzip
+			pr.Out.Header.Del("Accept-Encoding")
+		},
+		ModifyResponse: rec.record,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.ErrorContext(r.Context(), "Upstream request failed", "upstream", upstream.Host, "error", err)
+			problem.Write(w, r, problem.BadGateway("the upstream API is unavailable"))
+		},
+	}
+	return rec, nil
+}
+
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidBody(err))
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	req := rec.opts.redactor.request(r, body)
+	rec.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), recordingContext{}, req)))
+}
+
+// record saves the response of the upstream with its request.
+func (rec *Recorder) record(resp *http.Response) error {
+	req, _ := resp.Request.Context().Value(recordingContext{}).(*RecordedRequest)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading the upstream response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	redact := &rec.opts.redactor
+	header := redact.header(resp.Header)
+	for _, name := range perResponseHeaders {
+		header.Del(name)
+	}
+	recording := &Recording{
+		RecordedAt: time.Now().UTC(),
+		Upstream:   rec.upstream.String(),
+		Request:    *req,
+		Response: RecordedResponse{
+			Status: resp.StatusCode,
+			Header: header,
+			Body:   newBody(redact.body(body, resp.Header.Get("Content-Type"))),
+		},
+	}
+
+	rec.mu.Lock()
+	rec.seq++
+	err = recording.save(rec.dir, rec.seq)
+	rec.mu.Unlock()
+	if err != nil {
+		// The client still gets the response
+		slog.ErrorContext(resp.Request.Context(), "Saving the recording failed", "error", err)
+		return nil
+	}
+	slog.InfoContext(resp.Request.Context(), "📼 Recorded", "recording", recording.ID, "status", resp.StatusCode)
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package recorder records the traffic of an upstream API through a proxy, with secrets redacted,
+// and replays it offline.
+//
+// Each request and response pair is a JSON file of the recordings directory, named in recording order,
+// e.g. 0003_POST_v2_checkout_orders.json. Files can be edited by hand, or removed. They aren't fixtures
+// of the REST mock, Fixtures converts them.
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Recording is a recorded request and response pair.
+type Recording struct {
+	// ID is the file name, without the extension
+	ID         string           `json:"-"`
+	RecordedAt time.Time        `json:"recorded_at"`
+	Upstream   string           `json:"upstream"`
+	Request    RecordedRequest  `json:"request"`
+	Response   RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the request received by the proxy, before forwarding it.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body
+}
+
+// RecordedResponse is the response of the upstream.
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body
+}
+
+// Body is a body as JSON when it's JSON, as text when it's UTF-8, in base64 otherwise.
+type Body struct {
+	Text   string          `json:"body,omitempty"`
+	JSON   json.RawMessage `json:"body_json,omitempty"`
+	Base64 []byte          `json:"body_base64,omitempty"`
+}
+
+func newBody(data []byte) Body {
+	switch {
+	case len(data) == 0:
+		return Body{}
+	case json.Valid(data):
+		var compact bytes.Buffer
+		json.Compact(&compact, data)
+		return Body{JSON: compact.Bytes()}
+	case utf8.Valid(data):
+		return Body{Text: string(data)}
+	}
+	return Body{Base64: data}
+}
+
+// Bytes returns the body, JSON is compacted.
+func (b Body) Bytes() []byte {
+	switch {
+	case b.JSON != nil:
+		var compact bytes.Buffer
+		if json.Compact(&compact, b.JSON) != nil {
+			return b.JSON
+		}
+		return compact.Bytes()
+	case b.Text != "":
+		return []byte(b.Text)
+	}
+	return b.Base64
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// save writes the recording as the file seq of dir.
+func (rec *Recording) save(dir string, seq int) error {
+	name := strings.Trim(unsafeChars.ReplaceAllString(rec.Request.Path, "_"), "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	rec.ID = fmt.Sprintf("%04d_%s_%s", seq, rec.Request.Method, name)
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, rec.ID+".json"), append(data, '\n'), 0o644)
+}
+
+// LoadDir reads the recordings of dir, in recording order.
+func LoadDir(dir string) ([]*Recording, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+	recordings := make([]*Recording, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		rec := &Recording{ID: strings.TrimSuffix(filepath.Base(file), ".json")}
+		if err := json.Unmarshal(data, rec); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		recordings = append(recordings, rec)
+	}
+	return recordings, nil
+}
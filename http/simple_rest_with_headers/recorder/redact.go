@@ -0,0 +1,109 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	// Local
+	"local/shared/middleware"
+)
+
+// Redacted replaces secret values in recordings.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedHeaders are the headers redacted by default.
+var DefaultRedactedHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+	"X-API-KEY", "X-Signature", "Stripe-Signature", "PayPal-Auth-Assertion",
+}
+
+// DefaultRedactedFields are the JSON, form and query fields redacted by default, at any depth.
+var DefaultRedactedFields = []string{
+	"access_token", "refresh_token", "id_token", "client_secret", "client_id",
+	"password", "secret", "api_key", "token",
+}
+
+// redactor redacts headers, and fields of JSON bodies, form bodies and queries, case insensitively.
+type redactor struct {
+	headers []string
+	fields  []string
+}
+
+func (rd *redactor) header(h http.Header) http.Header {
+	h = h.Clone()
+	for name := range h {
+		if slices.ContainsFunc(rd.headers, func(s string) bool { return strings.EqualFold(s, name) }) {
+			h[name] = []string{Redacted}
+		}
+	}
+	return h
+}
+
+func (rd *redactor) field(name string) bool {
+	return slices.ContainsFunc(rd.fields, func(s string) bool { return strings.EqualFold(s, name) })
+}
+
+func (rd *redactor) query(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil || rawQuery == "" {
+		return rawQuery
+	}
+	for name := range values {
+		if rd.field(name) {
+			values[name] = []string{Redacted}
+		}
+	}
+	return values.Encode()
+}
+
+// body redacts JSON and form bodies, of the contentType.
+func (rd *redactor) body(data []byte, contentType string) []byte {
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return []byte(rd.query(string(data)))
+	}
+	// UseNumber keeps the numbers as they are
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if decoder.Decode(&v) != nil {
+		return data
+	}
+	redacted, _ := json.Marshal(rd.json(v))
+	return redacted
+}
+
+func (rd *redactor) json(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if rd.field(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = rd.json(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = rd.json(value)
+		}
+	}
+	return v
+}
+
+// request returns the redacted recording of r, of the body read from it.
+func (rd *redactor) request(r *http.Request, body []byte) *RecordedRequest {
+	header := rd.header(r.Header)
+	header.Del("Content-Length")
+	header.Del(middleware.RequestIDHeader)
+	return &RecordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  rd.query(r.URL.RawQuery),
+		Header: header,
+		Body:   newBody(rd.body(body, r.Header.Get("Content-Type"))),
+	}
+}
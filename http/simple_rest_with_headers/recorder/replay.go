@@ -0,0 +1,160 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	// Local
+	"local/shared/problem"
+)
+
+// Rules tell which parts of a request must be equal to the recorded one, besides the method and path.
+// Secret values are redacted on both sides before comparing them.
+type Rules struct {
+	Query   bool
+	Body    bool
+	Headers []string
+}
+
+// DefaultRules match the method, path and query.
+var DefaultRules = Rules{Query: true}
+
+// ParseRules parses comma separated rules, e.g. "query,body,header:PayPal-Request-Id".
+func ParseRules(s string) (Rules, error) {
+	var rules Rules
+	for _, rule := range strings.Split(s, ",") {
+		switch rule = strings.TrimSpace(rule); {
+		case rule == "" || rule == "method" || rule == "path":
+		case rule == "query":
+			rules.Query = true
+		case rule == "body":
+			rules.Body = true
+		case strings.HasPrefix(rule, "header:"):
+			rules.Headers = append(rules.Headers, strings.TrimPrefix(rule, "header:"))
+		default:
+			return Rules{}, fmt.Errorf("unknown match rule %q, want query, body or header:<name>", rule)
+		}
+	}
+	return rules, nil
+}
+
+func (rules Rules) String() string {
+	parts := []string{"method", "path"}
+	if rules.Query {
+		parts = append(parts, "query")
+	}
+	if rules.Body {
+		parts = append(parts, "body")
+	}
+	for _, h := range rules.Headers {
+		parts = append(parts, "header:"+h)
+	}
+	return strings.Join(parts, ",")
+}
+
+// key returns what the rules compare of req.
+func (rules Rules) key(req *RecordedRequest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", req.Method, req.Path)
+	if rules.Query {
+		fmt.Fprintf(&b, "\nquery:%s", req.Query)
+	}
+	for _, h := range rules.Headers {
+		fmt.Fprintf(&b, "\n%s:%s", strings.ToLower(h), strings.Join(req.Header.Values(h), ","))
+	}
+	if rules.Body {
+		fmt.Fprintf(&b, "\nbody:%s", req.Body.Bytes())
+	}
+	return b.String()
+}
+
+// Replayer answers requests with the recordings matching them.
+// Several recordings of the same request are replayed in order, repeating the last one,
+// so polling an order shows it changing status like it did while recording.
+type Replayer struct {
+	opts options
+
+	mu     sync.Mutex
+	byKey  map[string][]*Recording
+	served map[string]int
+	// byPath lists the recordings of a method and path, for the error of unmatched requests
+	byPath map[string][]string
+}
+
+// NewReplayer creates a Replayer of recordings.
+func NewReplayer(recordings []*Recording, opts ...Option) *Replayer {
+	rp := &Replayer{
+		opts:   newOptions(opts),
+		byKey:  map[string][]*Recording{},
+		served: map[string]int{},
+		byPath: map[string][]string{},
+	}
+	for _, rec := range recordings {
+		key := rp.opts.rules.key(&rec.Request)
+		rp.byKey[key] = append(rp.byKey[key], rec)
+		path := rec.Request.Method + " " + rec.Request.Path
+		rp.byPath[path] = append(rp.byPath[path], rec.ID)
+	}
+	return rp
+}
+
+// next returns the recording to replay for key.
+func (rp *Replayer) next(key string) (*Recording, bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	recordings := rp.byKey[key]
+	if len(recordings) == 0 {
+		return nil, false
+	}
+	i := min(rp.served[key], len(recordings)-1)
+	rp.served[key]++
+	return recordings[i], true
+}
+
+func (rp *Replayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidBody(err))
+		return
+	}
+	rec, ok := rp.next(rp.opts.rules.key(rp.opts.redactor.request(r, body)))
+	if !ok {
+		others := rp.byPath[r.Method+" "+r.URL.Path]
+		slog.WarnContext(r.Context(), "No recording matches", "rules", rp.opts.rules.String(), "recordings_of_path", len(others))
+		detail := fmt.Sprintf("no recording matches %s %s with the rules %s", r.Method, r.URL.Path, rp.opts.rules)
+		p := problem.New(http.StatusNotFound, problem.TypeBlank, detail)
+		if len(others) > 0 {
+			// Recorded with another query, body or headers
+			p.With("recordings", others)
+		}
+		problem.Write(w, r, p)
+		return
+	}
+
+	for name, values := range rec.Response.Header {
+		if !slices.ContainsFunc(perResponseHeaders, func(h string) bool { return strings.EqualFold(h, name) }) {
+			w.Header()[name] = values
+		}
+	}
+	w.Header().Set("X-Recording", rec.ID)
+	w.WriteHeader(rec.Response.Status)
+	w.Write(rec.Response.Body.Bytes())
+}
+
+// LoadReplayer creates a Replayer of the recordings of dir.
+func LoadReplayer(dir string, opts ...Option) (*Replayer, error) {
+	recordings, err := LoadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(recordings) == 0 {
+		// Likely a wrong path
+		return nil, fmt.Errorf("%s: no recordings", dir)
+	}
+	return NewReplayer(recordings, opts...), nil
+}
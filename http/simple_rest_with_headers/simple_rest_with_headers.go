@@ -3,27 +3,153 @@ package main
 // Mock Rest example
 
 import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"net/http"
+	"time"
+
+	// Local
+	"local/shared"
+	"local/shared/faults"
+	"local/shared/health"
+	"local/shared/logging"
+	"local/shared/metrics"
+	"local/shared/middleware"
+	"local/shared/openapi"
+	"local/shared/problem"
+	"simple_rest_with_headers/apikey"
+	"simple_rest_with_headers/fixtures"
+	"simple_rest_with_headers/hmacauth"
+	"simple_rest_with_headers/jwtauth"
 )
 
-// go run main.go
+// openapiSpec documents the routes, see openapi.Setup
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// go run .
 // test header: curl -H "X-API-KEY: secret123" http://localhost:8080/
+// See README.md for the keys of apikeys.json and how to test 401 and 403 responses
 func helloHandler(w http.ResponseWriter, r *http.Request) {
-	const requiredKey = "secret123"
-	apiKey := r.Header.Get("X-API-KEY")
+	fmt.Fprintln(w, "hello world")
+}
+
+// keysHandler lists the keys, without their hashes.
+func keysHandler(store *apikey.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"keys": store.Keys()})
+	}
+}
 
-	if apiKey != requiredKey {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintln(w, "Unauthorized: Missing or incorrect API key")
+// paymentRequest is the body of POST /payments.
+type paymentRequest struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// paymentsHandler mocks a payment, its requests are signed, see hmacauth.
+// go run ./cmd/signedreq -secret dev-hmac-secret-change-me -X POST -d '{"amount":1000,"currency":"EUR"}' http://localhost:8080/payments
+func paymentsHandler(w http.ResponseWriter, r *http.Request) {
+	var req paymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidBody(err))
+		return
+	}
+	if req.Amount <= 0 || req.Currency == "" {
+		problem.Write(w, r, problem.BadRequest("amount and currency are required"))
 		return
 	}
+	keyID, _ := hmacauth.KeyIDFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":       "pay_" + hmacauth.NewNonce(),
+		"status":   "succeeded",
+		"amount":   req.Amount,
+		"currency": req.Currency,
+		"key_id":   keyID,
+	})
+}
 
-	fmt.Fprintln(w, "hello world")
+// meHandler returns the claims of the bearer token.
+// curl -H "Authorization: Bearer $(go run ./cmd/jwt mint)" http://localhost:8080/me
+func meHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _ := jwtauth.FromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"sub": claims.Subject, "scopes": claims.Scopes(), "expires": claims.ExpiresAt.Time()})
 }
 
 func main() {
-	http.HandleFunc("/", helloHandler)
-	fmt.Println("Server listening on http://localhost:8080")
-	http.ListenAndServe(":8080", nil)
+	keysFile := flag.String("keys", "apikeys.json", "file of hashed API keys, see apikey.Store")
+	hmacKeysFile := flag.String("hmac-keys", "hmackeys.json", "file of request signing secrets, see hmacauth.LoadKeys")
+	hmacWindow := flag.Duration("hmac-window", hmacauth.DefaultWindow, "how far signed timestamps may be from the server clock")
+	fixturesDir := flag.String("fixtures", "fixtures", "directory of JSON and YAML route fixtures, see package fixtures")
+	jwksFile := flag.String("jwks", "jwks.json", "JWKS validating bearer tokens, see cmd/jwt")
+	jwtIssuer := flag.String("jwt-issuer", "mock-rest", "required iss of bearer tokens")
+	jwtAudience := flag.String("jwt-audience", "android-app", "required aud of bearer tokens")
+	flag.Parse()
+
+	logging.Setup("mock-rest")
+	store, err := apikey.Load(*keysFile)
+	if err != nil {
+		logging.Fatal("Loading API keys failed", logging.Err(err))
+	}
+	// Edits of the key file apply without restarting, e.g. to rotate keys
+	go store.Watch(context.Background(), 2*time.Second)
+	hmacKeys, err := hmacauth.LoadKeys(*hmacKeysFile)
+	if err != nil {
+		logging.Fatal("Loading HMAC keys failed", logging.Err(err))
+	}
+	verifier := hmacauth.NewVerifier(hmacKeys, hmacauth.WithWindow(*hmacWindow))
+	jwks, err := jwtauth.ReadJWKS(*jwksFile)
+	if err != nil {
+		logging.Fatal("Loading JWKS failed", logging.Err(err))
+	}
+	validator, err := jwtauth.NewValidator(jwks, jwtauth.WithIssuer(*jwtIssuer), jwtauth.WithAudience(*jwtAudience))
+	if err != nil {
+		logging.Fatal("Invalid JWKS", logging.Err(err))
+	}
+
+	mock, err := fixtures.New(*fixturesDir)
+	if err != nil {
+		logging.Fatal("Loading fixtures failed", logging.Err(err))
+	}
+	go mock.Watch(context.Background(), 2*time.Second)
+
+	// Scopes per route
+	http.Handle("/{$}", store.Require("hello:read")(http.HandlerFunc(helloHandler)))
+	http.Handle("GET /admin/keys", store.Require("admin")(keysHandler(store)))
+	http.Handle("POST /payments", verifier.Require(http.HandlerFunc(paymentsHandler)))
+	http.Handle("GET /me", validator.Require("profile:read")(http.HandlerFunc(meHandler)))
+	http.Handle("GET /.well-known/jwks.json", validator.JWKSHandler())
+	// Every other route is a fixture
+	http.Handle("/", mock)
+
+	http.Handle("GET /metrics", metrics.Handler())
+	health.Handle(nil)
+	// FAULTS_FILE rules, and /admin/faults when FAULTS_ADMIN is true, to test clients on flaky networks
+	if err := faults.Setup(nil); err != nil {
+		logging.Fatal("Invalid fault rules", logging.Err(err))
+	}
+	// GET /openapi.json, requests not matching it are answered with a problem
+	validate, err := openapi.Setup(nil, openapiSpec)
+	if err != nil {
+		logging.Fatal("Invalid OpenAPI document", logging.Err(err))
+	}
+	// CORS_ALLOWED_ORIGINS and the other CORS_* variables, for web clients
+	cors, err := middleware.CORSFromEnv(
+		middleware.AllowHeaders(apikey.Header, hmacauth.HeaderKeyID, hmacauth.HeaderTimestamp, hmacauth.HeaderNonce,
+			hmacauth.HeaderSignature, "X-Mock-Scenario"),
+		middleware.ExposeHeaders("WWW-Authenticate", fixtures.HeaderFixture),
+	)
+	if err != nil {
+		logging.Fatal("Invalid CORS config", logging.Err(err))
+	}
+	if err := shared.RunServer(":8080", cors(middleware.Default(validate(http.DefaultServeMux))), shared.WithName("Mock REST Server")); err != nil {
+		logging.Fatal("Mock REST Server failed", logging.Err(err))
+	}
 }
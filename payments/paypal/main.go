@@ -2,25 +2,55 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	_ "embed"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
 	// Local
 	"local/shared"
+	"local/shared/faults"
+	"local/shared/health"
+	"local/shared/httpclient"
+	"local/shared/logging"
+	"local/shared/metrics"
+	"local/shared/middleware"
+	"local/shared/openapi"
+	"local/shared/problem"
+	"local/shared/tracing"
 )
 
-const (
-	port    = "8081"
-	baseURL = "https://api-m.sandbox.paypal.com"
-)
+// openapiSpec documents the routes, see openapi.Setup
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// Config is loaded from the environment or .env, see shared.Bind
+type Config struct {
+	Port    string   `env:"PAYPAL_PORT" default:"8081"`
+	BaseURL *url.URL `env:"PAYPAL_BASE_URL" default:"https://api-m.sandbox.paypal.com"`
+	// From https://developer.paypal.com/dashboard/applications/sandbox
+	ClientID     string        `env:"PAYPAL_CLIENT_ID,required"`
+	ClientSecret shared.Secret `env:"PAYPAL_CLIENT_SECRET,required"`
+}
+
+var config Config
 
 var (
-	clientID     string
-	clientSecret string
+	paypalRequests = metrics.NewCounter("paypal_requests_total",
+		"PayPal API calls by operation and status code, \"error\" when PayPal didn't respond.", "operation", "code")
+	paypalDuration = metrics.NewHistogram("paypal_request_duration_seconds",
+		"PayPal API latencies by operation.", metrics.DefBuckets, "operation")
 )
 
 // region Requests
@@ -40,58 +70,173 @@ type OrderRequest struct {
 // region Responses
 // AuthResponse representa el token de PayPal
 type AuthResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
+	AccessToken shared.Secret `json:"access_token"`
+	TokenType   string        `json:"token_type"`
+	ExpiresIn   int           `json:"expires_in"`
+}
+
+// PaypalError is the body of failed PayPal API calls
+type PaypalError struct {
+	Name    string `json:"name"` // e.g. "UNPROCESSABLE_ENTITY"
+	Message string `json:"message"`
+	DebugID string `json:"debug_id"`
+	Details []struct {
+		Issue       string `json:"issue"` // e.g. "ORDER_NOT_APPROVED"
+		Description string `json:"description"`
+	} `json:"details"`
 }
 
 // endregion Responses
 
-func getEnvValue(key string) string {
-	val := os.Getenv(key)
-	if val == "" {
-		log.Fatalf("Couldn't load '%s', make sure it exists on your environment variables or on .env", key)
+// paypalClient times out slow PayPal responses, retries idempotent calls and fails fast while
+// PayPal is down. It propagates the trace context of the requests, see tracing.Transport
+var paypalClient = httpclient.New(
+	httpclient.WithTransport(tracing.NewTransport(nil)),
+	httpclient.WithTimeout(10*time.Second),
+	httpclient.WithMetrics("paypal"),
+)
+
+// paypalRequestID makes order calls safe to retry: PayPal answers a repeated PayPal-Request-Id
+// with the result of the first call. The ID is random per call, a client-sent X-Request-ID
+// could get the result of another call.
+func paypalRequestID(req *http.Request) *http.Request {
+	req.Header.Set("PayPal-Request-Id", rand.Text())
+	return httpclient.Idempotent(req)
+}
+
+// unavailableProblem converts a failed call to PayPal.
+func unavailableProblem(err error) *problem.Problem {
+	if errors.Is(err, httpclient.ErrCircuitOpen) {
+		return problem.New(http.StatusServiceUnavailable, problem.TypeUpstream, "PayPal is temporarily unavailable, try again later")
+	}
+	return problem.BadGateway("PayPal is not available")
+}
+
+// doPaypal sends req to PayPal, recording the metrics of operation.
+func doPaypal(operation string, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := paypalClient.Do(req)
+	paypalDuration.With(operation).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(res.StatusCode)
 	}
-	return val
+	paypalRequests.With(operation, code).Inc()
+	return res, err
+}
+
+// tokenCache keeps the access token until a minute before it expires
+var tokenCache struct {
+	sync.Mutex
+	token   shared.Secret
+	expires time.Time
 }
 
-func getAccessToken() (string, error) {
-	req, _ := http.NewRequest("POST", baseURL+"/v1/oauth2/token", bytes.NewBufferString("grant_type=client_credentials"))
-	req.SetBasicAuth(clientID, clientSecret)
+func getAccessToken(ctx context.Context) (string, error) {
+	tokenCache.Lock()
+	token, expires := tokenCache.token, tokenCache.expires
+	tokenCache.Unlock()
+	if !token.IsZero() && time.Now().Before(expires) {
+		return token.Reveal(), nil
+	}
+
+	// The lock isn't held while asking PayPal, concurrent requests may each get a token, the last one is kept
+	req, _ := http.NewRequestWithContext(ctx, "POST", config.BaseURL.JoinPath("/v1/oauth2/token").String(), bytes.NewBufferString("grant_type=client_credentials"))
+	req.SetBasicAuth(config.ClientID, config.ClientSecret.Reveal())
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	res, err := http.DefaultClient.Do(req)
+	// Asking for a token again is harmless
+	res, err := doPaypal("token", httpclient.Idempotent(req))
 	if err != nil {
 		return "", err
 	}
 	defer res.Body.Close()
 
-	body, _ := io.ReadAll(res.Body)
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("paypal access token: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("paypal access token: %s %s", res.Status, body)
+	}
 	var auth AuthResponse
 	if err := json.Unmarshal(body, &auth); err != nil {
 		return "", err
 	}
 
-	return auth.AccessToken, nil
+	tokenCache.Lock()
+	tokenCache.token = auth.AccessToken
+	tokenCache.expires = time.Now().Add(time.Duration(auth.ExpiresIn)*time.Second - time.Minute)
+	tokenCache.Unlock()
+	return auth.AccessToken.Reveal(), nil
+}
+
+// paypalProblem converts a failed PayPal response: order errors (e.g. not approved yet) keep
+// their status, while auth and server errors are ours, so they become a 502.
+func paypalProblem(res *http.Response, body []byte) *problem.Problem {
+	var paypalErr PaypalError
+	json.Unmarshal(body, &paypalErr)
+
+	status := res.StatusCode
+	if status == http.StatusUnauthorized || status == http.StatusForbidden || status >= 500 {
+		p := problem.BadGateway("PayPal request failed")
+		if paypalErr.DebugID != "" {
+			p.With("paypal_debug_id", paypalErr.DebugID)
+		}
+		return p
+	}
+
+	p := problem.New(status, problem.TypePaymentFailed, paypalErr.Message)
+	if len(paypalErr.Details) > 0 {
+		p.Detail = paypalErr.Details[0].Description
+		p.With("paypal_issue", paypalErr.Details[0].Issue)
+	}
+	if paypalErr.DebugID != "" {
+		p.With("paypal_debug_id", paypalErr.DebugID)
+	}
+	return p
+}
+
+// writePaypalResponse forwards a PayPal response, or its problem when it failed.
+func writePaypalResponse(w http.ResponseWriter, r *http.Request, res *http.Response) {
+	respBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Reading Paypal response failed", logging.Err(err))
+		problem.Write(w, r, unavailableProblem(err))
+		return
+	}
+	if res.StatusCode >= 400 {
+		slog.WarnContext(r.Context(), "Paypal request failed", "status", res.StatusCode, "body", string(respBody))
+		problem.Write(w, r, paypalProblem(res, respBody))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respBody)
 }
 
 // Creates a Paypal Payment order (similar to Stripe's Payment Intent).
 // Returns the orderID and approve links
 func createOrderHandler(w http.ResponseWriter, r *http.Request) {
-	accessToken, err := getAccessToken()
+	accessToken, err := getAccessToken(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		slog.ErrorContext(r.Context(), "Paypal access token failed", logging.Err(err))
+		problem.Write(w, r, unavailableProblem(err))
 		return
 	}
 
 	var request CreateOrderRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		log.Printf("➡️ [/create-order] Request decode error: %v", err)
-		http.Error(w, "invalid request", 400)
+		slog.WarnContext(r.Context(), "Invalid create order request", logging.Err(err))
+		problem.Write(w, r, problem.InvalidBody(err))
+		return
+	}
+	if request.ReturnUrlScheme == "" || request.ReturnUrlHost == "" {
+		problem.Write(w, r, problem.BadRequest("return_url_scheme and return_url_host are required"))
 		return
 	}
 
-	log.Printf("➡️ [/create-order] Request return_url_scheme: %s, return_url_host: %s", request.ReturnUrlHost, request.ReturnUrlHost)
+	slog.InfoContext(r.Context(), "Create order request", "return_url_scheme", request.ReturnUrlScheme, "return_url_host", request.ReturnUrlHost)
 
 	order := OrderRequest{
 		Intent: "CAPTURE",
@@ -112,50 +257,51 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 
 	body, _ := json.Marshal(order)
 
-	req, _ := http.NewRequest("POST", baseURL+"/v2/checkout/orders", bytes.NewBuffer(body))
+	req, _ := http.NewRequestWithContext(r.Context(), "POST", config.BaseURL.JoinPath("/v2/checkout/orders").String(), bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := doPaypal("create_order", paypalRequestID(req))
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		slog.ErrorContext(r.Context(), "Paypal create order failed", logging.Err(err))
+		problem.Write(w, r, unavailableProblem(err))
 		return
 	}
 	defer res.Body.Close()
 
-	respBody, _ := io.ReadAll(res.Body)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(respBody)
+	writePaypalResponse(w, r, res)
 }
 
 // Captures a previously payment already approved by the user.
 func captureOrderHandler(w http.ResponseWriter, r *http.Request) {
 	orderID := r.URL.Query().Get("orderId")
 	if orderID == "" {
-		http.Error(w, "missing orderId", 400)
+		problem.Write(w, r, problem.BadRequest("missing orderId"))
 		return
 	}
+	ctx := logging.With(r.Context(), logging.OrderID(orderID))
+	slog.InfoContext(ctx, "Capture order request")
 
-	accessToken, err := getAccessToken()
+	accessToken, err := getAccessToken(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		slog.ErrorContext(ctx, "Paypal access token failed", logging.Err(err))
+		problem.Write(w, r, unavailableProblem(err))
 		return
 	}
 
-	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/v2/checkout/orders/%s/capture", baseURL, orderID), nil)
+	req, _ := http.NewRequestWithContext(ctx, "POST", config.BaseURL.JoinPath("/v2/checkout/orders", orderID, "capture").String(), nil)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := doPaypal("capture_order", paypalRequestID(req))
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		slog.ErrorContext(ctx, "Paypal capture order failed", logging.Err(err))
+		problem.Write(w, r, unavailableProblem(err))
 		return
 	}
 	defer res.Body.Close()
 
-	respBody, _ := io.ReadAll(res.Body)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(respBody)
+	writePaypalResponse(w, r.WithContext(ctx), res)
 }
 
 // ⚠️ Before running:
@@ -165,16 +311,58 @@ func captureOrderHandler(w http.ResponseWriter, r *http.Request) {
 //	💡 Use a personal test account: https://developer.paypal.com/dashboard/accounts
 //
 // $ go run .
+// $ go run . -env mock   # or APP_ENV=mock, loads .env + .env.mock + .env.local
 func main() {
-	log.Printf("🚀 Paypal Server running on http://localhost:%s", port)
-	log.Printf("   🤖 Use http://10.0.2.2:%s/<api> on Android emulator", port)
+	profile := shared.ProfileFlag()
+	flag.Parse()
 
-	shared.LoadDotEnv(".env")
+	if _, err := shared.LoadEnv(".", shared.WithProfile(*profile)); err != nil {
+		logging.Fatal("Loading .env failed", logging.Err(err))
+	}
+	logging.Setup("paypal")
+	closeTraces, err := tracing.Setup("paypal")
+	if err != nil {
+		logging.Fatal("Invalid tracing config", logging.Err(err))
+	}
+	defer closeTraces()
 
-	clientID = getEnvValue("PAYPAL_CLIENT_ID")
-	clientSecret = getEnvValue("PAYPAL_CLIENT_SECRET")
+	// 💡 PAYPAL_BASE_URL is optional, e.g. PAYPAL_BASE_URL=https://${PAYPAL_HOST} on .env
+	if err := shared.Bind(&config); err != nil {
+		logging.Fatal("Invalid config, make sure the variables exist on your environment or on .env", logging.Err(err))
+	}
 
 	http.HandleFunc("/create-order", createOrderHandler)
 	http.HandleFunc("/capture-order", captureOrderHandler)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	http.Handle("GET /metrics", metrics.Handler())
+
+	// Readiness: PayPal OAuth answers, or the token is cached
+	health.Add("config", func(context.Context) error {
+		if config.ClientID == "" || config.ClientSecret.IsZero() {
+			return errors.New("PAYPAL_CLIENT_ID or PAYPAL_CLIENT_SECRET is not set")
+		}
+		return nil
+	})
+	health.Add("paypal", func(ctx context.Context) error {
+		_, err := getAccessToken(ctx)
+		return err
+	})
+	health.Handle(nil)
+	// FAULTS_FILE rules, and /admin/faults when FAULTS_ADMIN is true, to test clients on flaky networks
+	if err := faults.Setup(nil); err != nil {
+		logging.Fatal("Invalid fault rules", logging.Err(err))
+	}
+	// GET /openapi.json, requests not matching it are answered with a problem
+	validate, err := openapi.Setup(nil, openapiSpec)
+	if err != nil {
+		logging.Fatal("Invalid OpenAPI document", logging.Err(err))
+	}
+	// CORS_ALLOWED_ORIGINS and the other CORS_* variables, for web clients
+	cors, err := middleware.CORSFromEnv()
+	if err != nil {
+		logging.Fatal("Invalid CORS config", logging.Err(err))
+	}
+	if err := shared.RunServer(":"+config.Port, cors(middleware.Default(validate(http.DefaultServeMux))), shared.WithName("Paypal Server")); err != nil {
+		closeTraces() // logging.Fatal skips the deferred calls
+		logging.Fatal("Server failed", logging.Err(err))
+	}
 }
@@ -1,27 +1,103 @@
 package main
 
 import (
+	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/stripe/stripe-go/v78"
-	"github.com/stripe/stripe-go/v78/paymentintent"
+	"github.com/stripe/stripe-go/v78/client"
 	"github.com/stripe/stripe-go/webhook"
 
 	// Local
 	"local/shared"
+	"local/shared/faults"
+	"local/shared/health"
+	"local/shared/logging"
+	"local/shared/metrics"
+	"local/shared/middleware"
+	"local/shared/openapi"
+	"local/shared/problem"
+	"local/shared/tracing"
 )
 
-const port = "8080"
+// openapiSpec documents the routes, see openapi.Setup
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// Config is loaded from the environment or ../.env, see shared.Bind
+type Config struct {
+	Port string `env:"STRIPE_PORT" default:"8080"`
+	// From https://dashboard.stripe.com/test/apikeys
+	SecretKey shared.Secret `env:"STRIPE_SECRET_KEY,required"`
+	// Signing secret of the webhook endpoint, e.g. from `stripe listen --forward-to localhost:8080/webhook`
+	WebhookSecret shared.Secret `env:"STRIPE_WEBHOOK_SECRET,required"`
+}
+
+// Swapped while running when ../.env files change, e.g. a rotated STRIPE_SECRET_KEY
+var (
+	config    atomic.Pointer[Config]
+	stripeAPI atomic.Pointer[client.API]
+)
+
+var (
+	paymentIntents = metrics.NewCounter("stripe_payment_intents_total",
+		"PaymentIntents created by flow and result, the Stripe error type when it failed.", "flow", "result")
+	paymentIntentDuration = metrics.NewHistogram("stripe_payment_intent_duration_seconds",
+		"PaymentIntent creation latencies by flow.", metrics.DefBuckets, "flow")
+	webhookEvents = metrics.NewCounter("stripe_webhook_events_total",
+		"Webhook events by type and result: handled, ignored or invalid.", "type", "result")
+)
+
+func loadConfig() error {
+	var cfg Config
+	if err := shared.Bind(&cfg); err != nil {
+		return err
+	}
+	config.Store(&cfg)
+	// Requests to Stripe are client spans of the request being served, see createPaymentIntent
+	httpClient := &http.Client{Transport: tracing.NewTransport(nil), Timeout: 80 * time.Second}
+	stripeAPI.Store(client.New(cfg.SecretKey.Reveal(), stripe.NewBackends(httpClient)))
+	return nil
+}
 
 // run with `go run .`
+// or `go run . -env staging` (or APP_ENV=staging) to load ../.env + ../.env.staging + ../.env.local
 func main() {
-	// Set Stripe secret key
-	shared.LoadDotEnv("../.env")
-	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+	profile := shared.ProfileFlag()
+	flag.Parse()
+
+	// Set Stripe secret key, ../.env files are optional when the variables are already exported
+	watcher, err := shared.WatchEnv(context.Background(), "..", 2*time.Second, shared.WithProfile(*profile))
+	logging.Setup("stripe") // after loading the env files, which may set LOG_LEVEL and LOG_FORMAT
+	if err != nil {
+		logging.Fatal("Loading env failed", logging.Err(err))
+	}
+	closeTraces, err := tracing.Setup("stripe")
+	if err != nil {
+		logging.Fatal("Invalid tracing config", logging.Err(err))
+	}
+	defer closeTraces()
+	if err := loadConfig(); err != nil {
+		logging.Fatal("Invalid config", logging.Err(err))
+	}
+	watcher.OnChange(func(changes []shared.EnvChange) {
+		slog.Info("🔄 .env changed", "changes", changes)
+		if err := loadConfig(); err != nil {
+			slog.Error("Keeping the previous config", logging.Err(err))
+		}
+	})
+	port := config.Load().Port // 💡 changing the port requires a restart
 
 	// Register routes
 	http.HandleFunc("/create-one-click-checkout-card-payment-intent", handleCreateOneClickCheckoutCardPaymentIntent)
@@ -29,10 +105,41 @@ func main() {
 
 	// TODO register webhook on Stripe
 	http.HandleFunc("/webhook", handleStripeWebhook)
+	http.Handle("GET /metrics", metrics.Handler())
 
-	log.Printf("🚀 Stripe Server running on http://localhost:%s", port)
-	log.Printf("   🤖 Use http://10.0.2.2:%s/<api> on Android emulator", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	// Readiness: the config is loaded with a Stripe key, it's reloaded when ../.env files change
+	health.Add("config", func(context.Context) error {
+		if config.Load() == nil {
+			return errors.New("config not loaded")
+		}
+		return nil
+	})
+	health.Add("stripe", func(context.Context) error {
+		key := config.Load().SecretKey.Reveal()
+		if !strings.HasPrefix(key, "sk_") && !strings.HasPrefix(key, "rk_") {
+			return errors.New("STRIPE_SECRET_KEY is not a secret (sk_) or restricted (rk_) key")
+		}
+		return nil
+	})
+	health.Handle(nil)
+	// FAULTS_FILE rules, and /admin/faults when FAULTS_ADMIN is true, to test clients on flaky networks
+	if err := faults.Setup(nil); err != nil {
+		logging.Fatal("Invalid fault rules", logging.Err(err))
+	}
+	// GET /openapi.json, requests not matching it are answered with a problem
+	validate, err := openapi.Setup(nil, openapiSpec)
+	if err != nil {
+		logging.Fatal("Invalid OpenAPI document", logging.Err(err))
+	}
+	// CORS_ALLOWED_ORIGINS and the other CORS_* variables, for web clients
+	cors, err := middleware.CORSFromEnv(middleware.AllowHeaders("Stripe-Signature"))
+	if err != nil {
+		logging.Fatal("Invalid CORS config", logging.Err(err))
+	}
+	if err := shared.RunServer(":"+port, cors(middleware.Default(validate(http.DefaultServeMux))), shared.WithName("Stripe Server")); err != nil {
+		closeTraces() // logging.Fatal skips the deferred calls
+		logging.Fatal("Stripe Server failed", logging.Err(err))
+	}
 }
 
 type PaymentIntentRequest struct {
@@ -47,6 +154,27 @@ type PaymentIntentResponse struct {
 	ClientSecret string `json:"clientSecret"`
 }
 
+// String redacts the client secret on logs, the JSON response keeps the actual value.
+func (r PaymentIntentResponse) String() string {
+	return fmt.Sprintf("{clientSecret=%s}", shared.NewSecret(r.ClientSecret))
+}
+
+// LogValue redacts the client secret on structured logs.
+func (r PaymentIntentResponse) LogValue() slog.Value {
+	return slog.GroupValue(slog.Any("client_secret", shared.NewSecret(r.ClientSecret)))
+}
+
+// LogValue logs the request fields, the user ID with the logging.UserID key.
+func (r PaymentIntentRequest) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("method_id", r.PaymentMethodID),
+		slog.Int64("amount", r.Amount),
+		slog.String("currency", r.Currency),
+		logging.UserID(r.UserId),
+		slog.String("product_id", r.ProductId),
+	)
+}
+
 /*
 * Confirmation
   - **One-click checkout** - Backend confirms (`Confirm: true`):
@@ -64,16 +192,61 @@ type PaymentIntentResponse struct {
   - In Android, configure an intent filter in `AndroidManifest.xml` for the URL scheme.
 */
 
+// stripeProblem converts a Stripe error: card errors (e.g. declined) are shown to the user
+// as a 402, invalid requests keep their status and the rest become a 502.
+func stripeProblem(err error) *problem.Problem {
+	var stripeErr *stripe.Error
+	if !errors.As(err, &stripeErr) {
+		return problem.BadGateway("Stripe is not available")
+	}
+	var p *problem.Problem
+	switch {
+	case stripeErr.Type == stripe.ErrorTypeCard:
+		p = problem.New(http.StatusPaymentRequired, problem.TypePaymentFailed, stripeErr.Msg)
+		if stripeErr.DeclineCode != "" {
+			p.With("decline_code", string(stripeErr.DeclineCode))
+		}
+	case stripeErr.Type == stripe.ErrorTypeInvalidRequest && stripeErr.HTTPStatusCode < 500 &&
+		stripeErr.HTTPStatusCode != http.StatusUnauthorized:
+		p = problem.New(http.StatusBadRequest, problem.TypeInvalidRequest, stripeErr.Msg)
+	default:
+		p = problem.BadGateway("Stripe request failed")
+	}
+	if stripeErr.Code != "" {
+		p.With("stripe_code", string(stripeErr.Code))
+	}
+	return p
+}
+
+// createPaymentIntent creates a PaymentIntent, recording the metrics of flow.
+func createPaymentIntent(ctx context.Context, flow string, params *stripe.PaymentIntentParams) (*stripe.PaymentIntent, error) {
+	params.Context = ctx
+	start := time.Now()
+	intent, err := stripeAPI.Load().PaymentIntents.New(params)
+	paymentIntentDuration.With(flow).Observe(time.Since(start).Seconds())
+
+	result := "created"
+	if err != nil {
+		result = "error"
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.Type != "" {
+			result = string(stripeErr.Type)
+		}
+	}
+	paymentIntents.With(flow, result).Inc()
+	return intent, err
+}
+
 func handleCreateOneClickCheckoutCardPaymentIntent(w http.ResponseWriter, r *http.Request) {
 	var req PaymentIntentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("‼️ Invalid OneClickCheckoutCardPaymentRequest:", err)
-		http.Error(w, "Invalid OneClickCheckoutCardPaymentRequest", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "Invalid OneClickCheckoutCardPaymentRequest", logging.Err(err))
+		problem.Write(w, r, problem.InvalidBody(err))
 		return
 	}
 
-	log.Printf("⬇️ OneClickCheckoutCardPaymentRequest:  {methodId=%s, amount=%d, currency=%s, userId=%s, productId=%s}\n",
-		req.PaymentMethodID, req.Amount, req.Currency, req.UserId, req.ProductId)
+	ctx := logging.With(r.Context(), logging.UserID(req.UserId))
+	slog.InfoContext(ctx, "⬇️ OneClickCheckoutCardPaymentRequest", "request", req)
 
 	params := &stripe.PaymentIntentParams{
 		PaymentMethod: stripe.String(req.PaymentMethodID),
@@ -100,16 +273,16 @@ func handleCreateOneClickCheckoutCardPaymentIntent(w http.ResponseWriter, r *htt
 		},
 	}
 
-	intent, err := paymentintent.New(params)
+	intent, err := createPaymentIntent(ctx, "one_click", params)
 	if err != nil {
-		log.Println("‼️ Stripe error:", err)
-		http.Error(w, "Failed to create payment intent", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Stripe error", logging.Err(err))
+		problem.Write(w, r, stripeProblem(err))
 		return
 	}
 
 	resp := PaymentIntentResponse{ClientSecret: intent.ClientSecret}
 
-	log.Printf("⬆️ OneClickCheckoutCardPaymentResponse: %s\n", resp)
+	slog.InfoContext(ctx, "⬆️ OneClickCheckoutCardPaymentResponse", "response", resp)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -118,13 +291,13 @@ func handleCreateOneClickCheckoutCardPaymentIntent(w http.ResponseWriter, r *htt
 func handleCreateUnconfirmedIntent(w http.ResponseWriter, r *http.Request) {
 	var req PaymentIntentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("‼️ Invalid UnconfirmedIntentRequest:", err)
-		http.Error(w, "Invalid UnconfirmedIntentRequest", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "Invalid UnconfirmedIntentRequest", logging.Err(err))
+		problem.Write(w, r, problem.InvalidBody(err))
 		return
 	}
 
-	log.Printf("⬇️ UnconfirmedIntentRequest:  {methodId=%s, amount=%d, currency=%s, userId=%s, productId=%s}\n",
-		req.PaymentMethodID, req.Amount, req.Currency, req.UserId, req.ProductId)
+	ctx := logging.With(r.Context(), logging.UserID(req.UserId))
+	slog.InfoContext(ctx, "⬇️ UnconfirmedIntentRequest", "request", req)
 
 	params := &stripe.PaymentIntentParams{
 		Amount:        stripe.Int64(req.Amount),
@@ -136,10 +309,10 @@ func handleCreateUnconfirmedIntent(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	intent, err := paymentintent.New(params)
+	intent, err := createPaymentIntent(ctx, "unconfirmed", params)
 	if err != nil {
-		log.Printf("‼️ Stripe error: %v", err)
-		http.Error(w, "Failed to create payment intent", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Stripe error", logging.Err(err))
+		problem.Write(w, r, stripeProblem(err))
 		return
 	}
 
@@ -147,47 +320,49 @@ func handleCreateUnconfirmedIntent(w http.ResponseWriter, r *http.Request) {
 		ClientSecret: intent.ClientSecret,
 	}
 
-	log.Printf("⬆️ UnconfirmedIntentResponse: %s\n", resp)
+	slog.InfoContext(ctx, "⬆️ UnconfirmedIntentResponse", "response", resp)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
 func handleStripeWebhook(w http.ResponseWriter, r *http.Request) {
-	const MaxBodyBytes = int64(65536)
+	const MaxBodyBytes = int64(65536) // 💡 tighter than middleware.DefaultMaxBodySize, events are small
 	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
 	payload, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Error reading body: %v\n", err)
-		w.WriteHeader(http.StatusServiceUnavailable)
+		slog.ErrorContext(r.Context(), "Error reading body", logging.Err(err))
+		problem.Write(w, r, problem.InvalidBody(err))
 		return
 	}
 
 	sigHeader := r.Header.Get("Stripe-Signature")
-	endpointSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
-
-	event, err := webhook.ConstructEvent(payload, sigHeader, endpointSecret)
+	event, err := webhook.ConstructEvent(payload, sigHeader, config.Load().WebhookSecret.Reveal())
 	if err != nil {
-		log.Printf("⚠️ Webhook signature verification failed: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "Webhook signature verification failed", logging.Err(err))
+		webhookEvents.With("unknown", "invalid").Inc()
+		problem.Write(w, r, problem.BadRequest("invalid Stripe-Signature"))
 		return
 	}
 
 	if event.Type == "payment_intent.succeeded" {
 		var intent stripe.PaymentIntent
 		if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
-			log.Printf("Error parsing webhook JSON: %v\n", err)
-			w.WriteHeader(http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "Error parsing webhook JSON", logging.Err(err))
+			webhookEvents.With(string(event.Type), "invalid").Inc()
+			problem.Write(w, r, problem.InvalidBody(err))
 			return
 		}
 
-		userId := intent.Metadata["userId"]
-		productId := intent.Metadata["productId"]
-
-		log.Printf("✅💰 Payment succeeded for user %s, product %s", userId, productId)
+		slog.InfoContext(r.Context(), "💰 Payment succeeded",
+			logging.UserID(intent.Metadata["userId"]),
+			"product_id", intent.Metadata["productId"],
+			"payment_intent_id", intent.ID)
 		// TODO Save details to database
+		webhookEvents.With(string(event.Type), "handled").Inc()
 	} else {
-		log.Printf("Unhandled event type: %s", event.Type)
+		slog.DebugContext(r.Context(), "Unhandled event type", "type", event.Type)
+		webhookEvents.With(string(event.Type), "ignored").Inc()
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"local/shared"
+)
+
+const usage = `Encrypts values of .env files with AES-GCM, see shared.EncryptValue.
+
+Usage:
+  envcrypt keygen [-o .env.key]                 Creates a new key file
+  envcrypt encrypt [-all] [-keys A,B] [-w] FILE Encrypts secret values (*_SECRET, *_KEY, ...)
+  envcrypt decrypt [-w] FILE                    Decrypts encrypted values
+  envcrypt edit FILE                            Opens the decrypted file on $EDITOR and encrypts it back
+
+The key is read from $DOTENV_KEY, the file at $DOTENV_KEY_FILE or .env.key next to FILE.
+Without -w the result is written to stdout.
+`
+
+// $ go run ./cmd/envcrypt keygen -o ../payments/.env.key
+// $ go run ./cmd/envcrypt encrypt -w ../payments/.env
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "keygen":
+		err = keygen(args)
+	case "encrypt":
+		err = encrypt(args)
+	case "decrypt":
+		err = decrypt(args)
+	case "edit":
+		err = edit(args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("‼️ %v", err)
+	}
+}
+
+func keygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("o", shared.EnvKeyFile, "key file")
+	fs.Parse(args)
+
+	key, err := shared.GenerateEnvKey()
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintln(file, key); err != nil {
+		return err
+	}
+	log.Printf("✅ Key written to %s, don't commit it", *out)
+	return nil
+}
+
+func encrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	all := fs.Bool("all", false, "encrypt every value")
+	keys := fs.String("keys", "", "comma separated keys to encrypt, instead of the secret ones")
+	write := fs.Bool("w", false, "write the result to FILE")
+	path, err := parseFileArg(fs, args)
+	if err != nil {
+		return err
+	}
+
+	match := shared.IsSecretKey
+	switch {
+	case *all:
+		match = func(string) bool { return true }
+	case *keys != "":
+		selected := strings.Split(*keys, ",")
+		match = func(key string) bool { return slices.Contains(selected, key) }
+	}
+
+	key, src, err := readEnvFile(path)
+	if err != nil {
+		return err
+	}
+	out, err := shared.EncryptDotEnv(src, path, key, match)
+	if err != nil {
+		return err
+	}
+	return output(path, out, *write)
+}
+
+func decrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	write := fs.Bool("w", false, "write the result to FILE")
+	path, err := parseFileArg(fs, args)
+	if err != nil {
+		return err
+	}
+
+	key, src, err := readEnvFile(path)
+	if err != nil {
+		return err
+	}
+	out, _, err := shared.DecryptDotEnv(src, path, key)
+	if err != nil {
+		return err
+	}
+	return output(path, out, *write)
+}
+
+// edit decrypts FILE into a temporary file, opens it on $EDITOR and encrypts back
+// the previously encrypted keys together with the secret ones. Unchanged values keep
+// their encrypted text. On failure the temporary file is kept, so the edits aren't lost.
+func edit(args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	path, err := parseFileArg(fs, args)
+	if err != nil {
+		return err
+	}
+
+	key, src, err := readEnvFile(path)
+	if err != nil {
+		return err
+	}
+	plain, encryptedKeys, err := shared.DecryptDotEnv(src, path, key)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "envcrypt-*"+filepath.Ext(path))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(plain)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := editFile(tmp.Name(), plain, path, src, key, encryptedKeys); err != nil {
+		return fmt.Errorf("%w\nThe decrypted edits are kept in %s, delete it once done", err, tmp.Name())
+	}
+	return os.Remove(tmp.Name())
+}
+
+// editFile opens tmp, holding plain, on $EDITOR and writes it back encrypted to path.
+func editFile(tmp string, plain []byte, path string, src, key []byte, encryptedKeys []string) error {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	// e.g. EDITOR="code --wait"
+	editorArgs := strings.Fields(editor)
+	cmd := exec.Command(editorArgs[0], append(editorArgs[1:], tmp)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(edited, plain) {
+		log.Println("No changes")
+		return nil
+	}
+	out, err := shared.ReencryptDotEnv(edited, src, path, key, func(k string) bool {
+		return slices.Contains(encryptedKeys, k) || shared.IsSecretKey(k)
+	})
+	if err != nil {
+		return err
+	}
+	return output(path, out, true)
+}
+
+func parseFileArg(fs *flag.FlagSet, args []string) (string, error) {
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return "", errors.New("expected a single .env FILE, see -h")
+	}
+	return fs.Arg(0), nil
+}
+
+func readEnvFile(path string) ([]byte, []byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := shared.LoadEnvKey(filepath.Dir(path))
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, src, nil
+}
+
+func output(path string, data []byte, write bool) error {
+	if !write {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	log.Printf("✅ %s updated", path)
+	return nil
+}
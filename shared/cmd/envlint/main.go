@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"local/shared"
+	"local/shared/faults"
+	"local/shared/logging"
+	"local/shared/middleware"
+	"local/shared/openapi"
+	"local/shared/tracing"
+)
+
+// sharedVars are read by the shared packages the services use, they are never unused.
+var sharedVars = append([]string{
+	shared.ProfileEnvVar, shared.EnvKeyVar, shared.EnvKeyFileVar,
+	logging.LevelEnvVar, logging.FormatEnvVar,
+	tracing.ExporterEnvVar, tracing.FileEnvVar,
+	faults.FileEnvVar, faults.AdminEnvVar,
+	openapi.ResponsesEnvVar,
+}, envTags(middleware.CORSConfig{})...)
+
+// systemVars come from the OS, they are not expected on .env files.
+var systemVars = []string{"EDITOR", "HOME", "PATH", "SHELL", "TMPDIR", "USER"}
+
+// Checks a .env file against the variables the services need, reporting
+// missing, empty, unused and duplicate keys.
+//
+// $ cd shared
+// $ go run ./cmd/envlint -env ../payments/.env ../payments/paypal ../payments/stripe
+// $ go run ./cmd/envlint -example ../payments/.env.example ../payments
+func main() {
+	log.SetFlags(0)
+	envFile := flag.String("env", "", ".env file to check")
+	example := flag.String("example", "", "write a .env.example template to this file")
+	strict := flag.Bool("strict", false, "fail on warnings (unused and empty optional keys)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: envlint [-env FILE] [-example FILE] [-strict] DIR...\n\n")
+		fmt.Fprintf(os.Stderr, "Scans the Go files of DIR (default .) for env:\"KEY\" struct tags and os.Getenv calls.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dirs := flag.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	var services []*service
+	for _, dir := range dirs {
+		found, err := scanServices(dir)
+		if err != nil {
+			log.Fatalf("‼️ %v", err)
+		}
+		for _, svc := range found {
+			svc.Dir = filepath.Join(dir, svc.Dir)
+			for _, key := range systemVars {
+				delete(svc.Vars, key)
+			}
+		}
+		found = slices.DeleteFunc(found, func(svc *service) bool { return len(svc.Vars) == 0 })
+		services = append(services, found...)
+	}
+	if len(services) == 0 {
+		log.Fatalf("‼️ No env variables found on %s", strings.Join(dirs, ", "))
+	}
+
+	if *example != "" {
+		if err := os.WriteFile(*example, []byte(exampleFile(services)), 0o644); err != nil {
+			log.Fatalf("‼️ %v", err)
+		}
+		log.Printf("✅ %s written", *example)
+	}
+
+	if *envFile == "" {
+		return
+	}
+	errs, warnings, err := lint(*envFile, services)
+	if err != nil {
+		log.Fatalf("‼️ %v", err)
+	}
+	for _, msg := range errs {
+		log.Printf("‼️ %s", msg)
+	}
+	for _, msg := range warnings {
+		log.Printf("⚠️ %s", msg)
+	}
+	if len(errs) > 0 || (*strict && len(warnings) > 0) {
+		os.Exit(1)
+	}
+	log.Printf("✅ %s looks good for %d services", *envFile, len(services))
+}
+
+// lint compares the keys of envFile with the variables of services.
+func lint(envFile string, services []*service) (errs, warnings []string, err error) {
+	file, err := os.Open(envFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	entries, err := shared.ParseDotEnvEntries(file, envFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := map[string][]int{}
+	values := map[string]string{}
+	for _, entry := range entries {
+		lines[entry.Key] = append(lines[entry.Key], entry.Line)
+		values[entry.Key] = entry.Value
+	}
+
+	used := map[string]bool{}
+	for _, svc := range services {
+		for _, v := range svc.sortedVars() {
+			used[v.Key] = true
+			value, defined := values[v.Key]
+			switch {
+			case !defined && v.Required:
+				errs = append(errs, fmt.Sprintf("%s: missing %s, required by %s", envFile, v.Key, svc.Dir))
+			case defined && value == "" && v.Required:
+				errs = append(errs, fmt.Sprintf("%s:%d: empty %s, required by %s", envFile, last(lines[v.Key]), v.Key, svc.Dir))
+			case defined && value == "" && v.Default == "":
+				warnings = append(warnings, fmt.Sprintf("%s:%d: empty %s, used by %s", envFile, last(lines[v.Key]), v.Key, svc.Dir))
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(lines))
+	for key := range lines {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if len(lines[key]) > 1 {
+			errs = append(errs, fmt.Sprintf("%s:%d: duplicate %s, also defined at lines %v", envFile, last(lines[key]), key, lines[key][:len(lines[key])-1]))
+		}
+		if !used[key] && !slices.Contains(sharedVars, key) && !isReferenced(key, values) {
+			warnings = append(warnings, fmt.Sprintf("%s:%d: unused %s", envFile, lines[key][0], key))
+		}
+	}
+	return errs, warnings, nil
+}
+
+// envTags returns the keys of the env tags of the struct v, see shared.Bind.
+func envTags(v any) []string {
+	var keys []string
+	t := reflect.TypeOf(v)
+	for i := range t.NumField() {
+		if env, ok := t.Field(i).Tag.Lookup("env"); ok && env != "-" {
+			key, _, _ := strings.Cut(env, ",")
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// isReferenced reports whether other values reference key with ${key}.
+func isReferenced(key string, values map[string]string) bool {
+	for _, value := range values {
+		if strings.Contains(value, "${"+key+"}") || strings.Contains(value, "${"+key+":") {
+			return true
+		}
+	}
+	return false
+}
+
+func last(lines []int) int {
+	return lines[len(lines)-1]
+}
+
+// exampleFile returns a .env.example template with the variables of every service.
+func exampleFile(services []*service) string {
+	var sb strings.Builder
+	sb.WriteString("# Generated by shared/cmd/envlint, copy it to .env and fill the values\n")
+	written := map[string]bool{}
+	for _, svc := range services {
+		fmt.Fprintf(&sb, "\n# %s\n", svc.Dir)
+		for _, v := range svc.sortedVars() {
+			if written[v.Key] {
+				fmt.Fprintf(&sb, "# %s, see above\n", v.Key)
+				continue
+			}
+			written[v.Key] = true
+			if v.Doc != "" {
+				fmt.Fprintf(&sb, "# %s\n", v.Doc)
+			}
+			switch {
+			case v.Required:
+				fmt.Fprintf(&sb, "%s= # required\n", v.Key)
+			case v.Default != "":
+				fmt.Fprintf(&sb, "# %s=%s\n", v.Key, v.Default)
+			default:
+				fmt.Fprintf(&sb, "%s=\n", v.Key)
+			}
+		}
+	}
+	return sb.String()
+}
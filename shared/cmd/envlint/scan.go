@@ -0,0 +1,144 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// envVar is an environment variable used by a service.
+type envVar struct {
+	Key      string
+	Required bool
+	Default  string
+	Doc      string
+}
+
+// service groups the variables used by the Go files of a directory.
+type service struct {
+	Dir  string
+	Vars map[string]*envVar
+}
+
+// scanServices walks root looking for `env:"KEY"` struct tags (see shared.Bind)
+// and os.Getenv / os.LookupEnv calls with a literal key.
+func scanServices(root string) ([]*service, error) {
+	services := map[string]*service{}
+	fset := token.NewFileSet()
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		dir, _ := filepath.Rel(root, filepath.Dir(path))
+		svc := services[dir]
+		if svc == nil {
+			svc = &service{Dir: dir, Vars: map[string]*envVar{}}
+		}
+		scanFile(file, svc)
+		if len(svc.Vars) > 0 {
+			services[dir] = svc
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*service, 0, len(services))
+	for _, svc := range services {
+		out = append(out, svc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Dir < out[j].Dir })
+	return out, nil
+}
+
+func scanFile(file *ast.File, svc *service) {
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Field:
+			if n.Tag == nil {
+				return true
+			}
+			tag, err := strconv.Unquote(n.Tag.Value)
+			if err != nil {
+				return true
+			}
+			structTag := reflect.StructTag(tag)
+			env, ok := structTag.Lookup("env")
+			if !ok || env == "-" {
+				return true
+			}
+			key, opts, _ := strings.Cut(env, ",")
+			v := svc.add(key)
+			v.Default = structTag.Get("default")
+			v.Required = v.Required || (strings.Contains(opts, "required") && v.Default == "")
+			if v.Doc == "" {
+				v.Doc = fieldDoc(n)
+			}
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || len(n.Args) != 1 {
+				return true
+			}
+			if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "os" || (sel.Sel.Name != "Getenv" && sel.Sel.Name != "LookupEnv") {
+				return true
+			}
+			if lit, ok := n.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				if key, err := strconv.Unquote(lit.Value); err == nil {
+					svc.add(key)
+				}
+			}
+		}
+		return true
+	})
+}
+
+func (s *service) add(key string) *envVar {
+	v := s.Vars[key]
+	if v == nil {
+		v = &envVar{Key: key}
+		s.Vars[key] = v
+	}
+	return v
+}
+
+// sortedVars returns the variables of the service sorted by key.
+func (s *service) sortedVars() []*envVar {
+	vars := make([]*envVar, 0, len(s.Vars))
+	for _, v := range s.Vars {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Key < vars[j].Key })
+	return vars
+}
+
+func fieldDoc(field *ast.Field) string {
+	for _, group := range []*ast.CommentGroup{field.Doc, field.Comment} {
+		if text := strings.TrimSpace(group.Text()); text != "" {
+			return strings.ReplaceAll(text, "\n", " ")
+		}
+	}
+	return ""
+}
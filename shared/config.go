@@ -0,0 +1,215 @@
+package shared
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRequired is reported for `required` fields without a value.
+var ErrRequired = errors.New("required but not set")
+
+// FieldError describes a config field that couldn't be bound.
+type FieldError struct {
+	Field string // Go field path, e.g. "Config.ClientID"
+	Key   string // Environment variable
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.Key, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// BindError lists every missing or invalid field found by Bind.
+type BindError struct {
+	Fields []*FieldError
+}
+
+func (e *BindError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		msgs[i] = field.Error()
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// Bind fills the struct pointed by dst from the environment, using struct tags:
+//
+//	type Config struct {
+//		ClientID string        `env:"PAYPAL_CLIENT_ID,required"`
+//		Port     int           `env:"PAYPAL_PORT" default:"8081"`
+//		Timeout  time.Duration `env:"PAYPAL_TIMEOUT" default:"10s"`
+//		BaseURL  *url.URL      `env:"PAYPAL_BASE_URL" default:"https://api-m.sandbox.paypal.com"`
+//		Scopes   []string      `env:"PAYPAL_SCOPES" split:","`
+//	}
+//
+// Supports strings, bools, ints, uints, floats, time.Duration, url.URL,
+// encoding.TextUnmarshaler, pointers and slices of those. Nested structs
+// without an `env` tag are bound recursively.
+// Empty values count as not set. Every missing or invalid field is
+// reported at once in a *BindError.
+func Bind(dst any) error {
+	return bindConfig(dst, os.LookupEnv)
+}
+
+func bindConfig(dst any, lookup func(string) (string, bool)) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("shared.Bind: expected a pointer to a struct, got %T", dst)
+	}
+
+	b := &binder{lookup: lookup}
+	b.bindStruct(v.Elem(), v.Elem().Type().Name())
+	if len(b.errs) > 0 {
+		return &BindError{Fields: b.errs}
+	}
+	return nil
+}
+
+type binder struct {
+	lookup func(string) (string, bool)
+	errs   []*FieldError
+}
+
+func (b *binder) bindStruct(v reflect.Value, path string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldPath := path + "." + field.Name
+
+		tag, ok := field.Tag.Lookup("env")
+		if !ok {
+			if field.Type.Kind() == reflect.Struct && !isBindLeaf(field.Type) {
+				b.bindStruct(v.Field(i), fieldPath)
+			}
+			continue
+		}
+		if tag == "-" {
+			continue
+		}
+
+		key, opts, _ := strings.Cut(tag, ",")
+		required := false
+		for _, opt := range strings.Split(opts, ",") {
+			required = required || strings.TrimSpace(opt) == "required"
+		}
+
+		value, _ := b.lookup(key)
+		if value == "" {
+			value = field.Tag.Get("default")
+		}
+		if value == "" {
+			if required {
+				b.errs = append(b.errs, &FieldError{Field: fieldPath, Key: key, Err: ErrRequired})
+			}
+			continue
+		}
+
+		if err := setFieldValue(v.Field(i), value, field.Tag.Get("split")); err != nil {
+			b.errs = append(b.errs, &FieldError{Field: fieldPath, Key: key, Err: err})
+		}
+	}
+}
+
+var (
+	durationType        = reflect.TypeFor[time.Duration]()
+	urlType             = reflect.TypeFor[url.URL]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// isBindLeaf reports whether a struct type is set from a single value instead of recursively.
+func isBindLeaf(t reflect.Type) bool {
+	return t == urlType || reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+func setFieldValue(v reflect.Value, raw string, sep string) error {
+	if v.Kind() == reflect.Pointer {
+		elem := reflect.New(v.Type().Elem())
+		if err := setFieldValue(elem.Elem(), raw, sep); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case urlType:
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid URL %q", raw)
+		}
+		v.Set(reflect.ValueOf(*u))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", v.Kind(), raw)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", v.Kind(), raw)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", v.Kind(), raw)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if sep == "" {
+			sep = ","
+		}
+		parts := strings.Split(raw, sep)
+		slice := reflect.MakeSlice(v.Type(), 0, len(parts))
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setFieldValue(elem, part, ""); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
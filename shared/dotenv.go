@@ -0,0 +1,241 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseError reports a malformed line in a .env file.
+type ParseError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// dotEnvEntry is a single KEY=value assignment, in file order.
+type dotEnvEntry struct {
+	Key   string
+	Value string
+	Line  int
+	// Literal values ('single quoted') are not expanded
+	Literal bool
+	// Start and End are the offsets of the raw value, quotes included, in the parsed source
+	Start, End int
+}
+
+// parseDotEnv parses the contents of a .env file.
+//
+// Supported grammar:
+//   - blank lines and lines starting with `#` are ignored
+//   - optional `export ` prefix: `export KEY=value`
+//   - unquoted values are trimmed and end at an inline comment (` # ...`)
+//   - 'single quoted' values are taken literally
+//   - "double quoted" values support \n, \r, \t, \", \\ and \$ escapes
+//   - quoted values may span several lines (PEM keys, JSON blobs, ...)
+//
+// Values are returned unexpanded, see expandDotEnv for the ${VAR} syntax.
+//
+// Malformed lines don't stop the parsing, every problem is returned as a
+// *ParseError joined in the resulting error.
+func parseDotEnv(name string, src string) ([]dotEnvEntry, error) {
+	src = normalizeDotEnv(src)
+
+	p := &dotEnvParser{name: name, src: src, line: 1}
+	var entries []dotEnvEntry
+	var errs []error
+	for p.pos < len(p.src) {
+		entry, ok, err := p.parseStatement()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, errors.Join(errs...)
+}
+
+// normalizeDotEnv drops the UTF-8 BOM and CRLF line endings, entry offsets refer to the normalized source.
+func normalizeDotEnv(src string) string {
+	src = strings.TrimPrefix(src, "\ufeff")
+	return strings.ReplaceAll(src, "\r\n", "\n")
+}
+
+type dotEnvParser struct {
+	name string
+	src  string
+	pos  int
+	line int
+}
+
+func (p *dotEnvParser) errorf(line int, format string, args ...any) error {
+	return &ParseError{File: p.name, Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *dotEnvParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *dotEnvParser) skipBlanks() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// restOfLine returns the text up to the end of the current line and moves to the next one.
+func (p *dotEnvParser) restOfLine() string {
+	rest := p.src[p.pos:]
+	end := strings.IndexByte(rest, '\n')
+	if end < 0 {
+		p.pos = len(p.src)
+		return rest
+	}
+	p.pos += end + 1
+	p.line++
+	return rest[:end]
+}
+
+func (p *dotEnvParser) parseStatement() (dotEnvEntry, bool, error) {
+	line := p.line
+	p.skipBlanks()
+	switch p.peek() {
+	case 0:
+		return dotEnvEntry{}, false, nil
+	case '\n', '#':
+		p.restOfLine()
+		return dotEnvEntry{}, false, nil
+	}
+
+	if rest := p.src[p.pos:]; strings.HasPrefix(rest, "export") && len(rest) > 6 && (rest[6] == ' ' || rest[6] == '\t') {
+		p.pos += 6
+		p.skipBlanks()
+	}
+
+	key := p.scanKey()
+	if key == "" {
+		text := strings.TrimSpace(p.restOfLine())
+		return dotEnvEntry{}, false, p.errorf(line, "expected variable name, got %q", text)
+	}
+	p.skipBlanks()
+	if p.peek() != '=' {
+		p.restOfLine()
+		return dotEnvEntry{}, false, p.errorf(line, "expected '=' after %q", key)
+	}
+	p.pos++
+	afterEquals := p.pos
+	p.skipBlanks()
+
+	entry := dotEnvEntry{Key: key, Line: line, Literal: p.peek() == '\'', Start: p.pos}
+	switch p.peek() {
+	case '#':
+		if p.pos > afterEquals {
+			// Empty value followed by a comment, e.g. `KEY= # comment`
+			entry.Start, entry.End = afterEquals, afterEquals
+			p.restOfLine()
+			break
+		}
+		entry.Value = p.scanUnquoted()
+		entry.End = entry.Start + len(entry.Value)
+	case '"', '\'':
+		var err error
+		if entry.Value, entry.End, err = p.scanQuoted(line); err != nil {
+			return dotEnvEntry{}, false, err
+		}
+	default:
+		entry.Value = p.scanUnquoted()
+		entry.End = entry.Start + len(entry.Value)
+	}
+	return entry, true, nil
+}
+
+func (p *dotEnvParser) scanKey() string {
+	start := p.pos
+	for p.pos < len(p.src) && isKeyChar(p.src[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func isKeyChar(c byte, first bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		return true
+	case c >= '0' && c <= '9', c == '.', c == '-':
+		return !first
+	}
+	return false
+}
+
+// scanUnquoted reads a value up to the end of the line, dropping inline comments.
+func (p *dotEnvParser) scanUnquoted() string {
+	value := p.restOfLine()
+	for i := 1; i < len(value); i++ {
+		if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			value = value[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// scanQuoted reads a single or double quoted value, which may span several lines.
+// Returns the value and the offset right after the closing quote.
+func (p *dotEnvParser) scanQuoted(line int) (string, int, error) {
+	quote := p.src[p.pos]
+	p.pos++
+
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return "", 0, p.errorf(line, "unterminated quoted value, missing closing %c", quote)
+		}
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			end, closingLine := p.pos, p.line
+			trailing := strings.TrimSpace(p.restOfLine())
+			if trailing != "" && !strings.HasPrefix(trailing, "#") {
+				return "", 0, p.errorf(closingLine, "unexpected %q after quoted value", trailing)
+			}
+			return sb.String(), end, nil
+		case c == '\n':
+			p.line++
+			sb.WriteByte(c)
+		case c == '\\' && quote == '"' && p.pos < len(p.src):
+			next := p.src[p.pos]
+			p.pos++
+			switch next {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case '"', '\\':
+				sb.WriteByte(next)
+			case '$':
+				// Escaped for expandDotEnv
+				sb.WriteString("$$")
+			case '\n':
+				// Escaped newline, keep it as a line break
+				p.line++
+				sb.WriteByte('\n')
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(next)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
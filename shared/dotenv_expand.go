@@ -0,0 +1,216 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// errFailedReference marks a value that references another failing value,
+// only the original failure is reported.
+var errFailedReference = errors.New("references a failing value")
+
+const (
+	expandPending = iota
+	expandRunning
+	expandDone
+)
+
+// envExpander resolves ${VAR} references between .env entries.
+type envExpander struct {
+	name      string
+	entries   []dotEnvEntry
+	lookupEnv func(string) (string, bool)
+	state     []int
+	stack     []string
+	errs      []error
+}
+
+// expandDotEnv expands in place the values of entries:
+//   - ${VAR} is replaced by the value of VAR, or "" when not set
+//   - ${VAR:-default} uses default when VAR is not set or empty
+//   - ${VAR:?message} fails with message when VAR is not set or empty
+//   - $$ is a literal $
+//
+// A reference resolves to the closest earlier key of the file, then to
+// lookupEnv and finally to a later key of the file. Reference cycles are
+// reported as errors.
+func expandDotEnv(name string, entries []dotEnvEntry, lookupEnv func(string) (string, bool)) error {
+	x := &envExpander{
+		name:      name,
+		entries:   entries,
+		lookupEnv: lookupEnv,
+		state:     make([]int, len(entries)),
+	}
+	for i := range entries {
+		x.resolve(i)
+	}
+	return errors.Join(x.errs...)
+}
+
+func (x *envExpander) errorf(i int, format string, args ...any) error {
+	return &ParseError{File: x.name, Line: x.entries[i].Line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// resolve expands the i-th entry once and returns its final value.
+func (x *envExpander) resolve(i int) (string, error) {
+	entry := &x.entries[i]
+	switch x.state[i] {
+	case expandDone:
+		return entry.Value, nil
+	case expandRunning:
+		cycle := append(slices.Clone(x.stack[x.indexInStack(entry.Key):]), entry.Key)
+		return "", fmt.Errorf("reference cycle %s", strings.Join(cycle, " -> "))
+	}
+	if entry.Literal {
+		x.state[i] = expandDone
+		return entry.Value, nil
+	}
+
+	x.state[i] = expandRunning
+	x.stack = append(x.stack, entry.Key)
+	value, err := x.expand(entry.Value, i)
+	x.stack = x.stack[:len(x.stack)-1]
+	x.state[i] = expandDone
+
+	if err != nil {
+		if !errors.Is(err, errFailedReference) {
+			x.errs = append(x.errs, x.errorf(i, "%s: %v", entry.Key, err))
+		}
+		entry.Value = ""
+		return "", errFailedReference
+	}
+	entry.Value = value
+	return value, nil
+}
+
+func (x *envExpander) indexInStack(key string) int {
+	for i := len(x.stack) - 1; i >= 0; i-- {
+		if x.stack[i] == key {
+			return i
+		}
+	}
+	return 0
+}
+
+// lookup finds the value of key as seen from the entry at index from.
+func (x *envExpander) lookup(key string, from int) (string, bool, error) {
+	for j := from - 1; j >= 0; j-- {
+		if x.entries[j].Key == key {
+			value, err := x.resolve(j)
+			return value, true, err
+		}
+	}
+	if value, ok := x.lookupEnv(key); ok {
+		return value, true, nil
+	}
+	for j := len(x.entries) - 1; j > from; j-- {
+		if x.entries[j].Key == key {
+			value, err := x.resolve(j)
+			return value, true, err
+		}
+	}
+	return "", false, nil
+}
+
+func (x *envExpander) expand(s string, from int) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			sb.WriteByte('$')
+			i++
+		case '{':
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated %q", s[i:])
+			}
+			value, err := x.expandExpr(s[i+2:end], from)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+			i = end
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// unescapeDollars returns s with $$ read as a literal $, as expand does, and whether s has ${...} references.
+func unescapeDollars(s string) (string, bool) {
+	var sb strings.Builder
+	references := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == '$' && i+1 < len(s) {
+			switch s[i+1] {
+			case '$':
+				i++
+			case '{':
+				references = true
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String(), references
+}
+
+// closingBrace returns the index of the `}` closing an expression that starts at start,
+// skipping nested ${...} expressions.
+func closingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (x *envExpander) expandExpr(expr string, from int) (string, error) {
+	n := 0
+	for n < len(expr) && isKeyChar(expr[n], n == 0) {
+		n++
+	}
+	key, rest := expr[:n], expr[n:]
+	if key == "" {
+		return "", fmt.Errorf("invalid variable name in ${%s}", expr)
+	}
+
+	value, found, err := x.lookup(key, from)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case rest == "":
+		return value, nil
+	case strings.HasPrefix(rest, ":-"):
+		if found && value != "" {
+			return value, nil
+		}
+		return x.expand(rest[2:], from)
+	case strings.HasPrefix(rest, ":?"):
+		if found && value != "" {
+			return value, nil
+		}
+		msg := rest[2:]
+		if msg == "" {
+			msg = "not set"
+		}
+		return "", fmt.Errorf("%s %s", key, msg)
+	}
+	return "", fmt.Errorf("unsupported expression ${%s}", expr)
+}
@@ -0,0 +1,148 @@
+package shared
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// kv is what the tests compare of a dotEnvEntry.
+type kv struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+func entriesOf(entries []dotEnvEntry) []kv {
+	var kvs []kv
+	for _, e := range entries {
+		kvs = append(kvs, kv{e.Key, e.Value, e.Line})
+	}
+	return kvs
+}
+
+// parseErrors returns the *ParseError joined in err.
+func parseErrors(t *testing.T, err error) []*ParseError {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("error %v isn't joined", err)
+	}
+	var errs []*ParseError
+	for _, err := range joined.Unwrap() {
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("error %v isn't a *ParseError", err)
+		}
+		errs = append(errs, parseErr)
+	}
+	return errs
+}
+
+func TestParseDotEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []kv
+	}{
+		{"empty", "", nil},
+		{"comments and blank lines", "# comment\n\n   \n  # indented comment\nA=1\n", []kv{{"A", "1", 5}}},
+		{"unquoted is trimmed", "A =  hello world  \n", []kv{{"A", "hello world", 1}}},
+		{"empty value", "A=\nB=2", []kv{{"A", "", 1}, {"B", "2", 2}}},
+		{"export prefix", "export A=1\nexport\tB=2\nexported=3", []kv{{"A", "1", 1}, {"B", "2", 2}, {"exported", "3", 3}}},
+		{"key characters", "a.b-c_1=x", []kv{{"a.b-c_1", "x", 1}}},
+		{"CRLF and BOM", "\ufeffA=1\r\nB=2\r\n", []kv{{"A", "1", 1}, {"B", "2", 2}}},
+
+		{"inline comment", "A=abc # comment", []kv{{"A", "abc", 1}}},
+		{"inline comment after tab", "A=abc\t# comment", []kv{{"A", "abc", 1}}},
+		{"hash without blank", "A=abc#def", []kv{{"A", "abc#def", 1}}},
+		{"hash starting the value", "A=#abc", []kv{{"A", "#abc", 1}}},
+		{"empty value and comment", "A= # comment\nB=2", []kv{{"A", "", 1}, {"B", "2", 2}}},
+		{"empty value and tab comment", "A=\t# comment", []kv{{"A", "", 1}}},
+
+		{"single quotes are literal", `A='a \n $B # c'`, []kv{{"A", `a \n $B # c`, 1}}},
+		{"double quotes keep hashes", `A="a # b"`, []kv{{"A", "a # b", 1}}},
+		{"escapes", `A="1\n2\r3\t4\"5\\6"`, []kv{{"A", "1\n2\r3\t4\"5\\6", 1}}},
+		// `\$` is kept escaped as "$$" for expandDotEnv
+		{"escaped dollar", `A="\$HOME"`, []kv{{"A", "$$HOME", 1}}},
+		{"unknown escape is kept", `A="a\qb"`, []kv{{"A", `a\qb`, 1}}},
+		{"comment after quotes", `A="a" # comment`, []kv{{"A", "a", 1}}},
+		{"empty quotes", `A=""` + "\nB=''", []kv{{"A", "", 1}, {"B", "", 2}}},
+
+		{"multi-line double quoted", "A=\"line 1\nline 2\"\nB=3", []kv{{"A", "line 1\nline 2", 1}, {"B", "3", 3}}},
+		{"multi-line single quoted", "KEY='-----BEGIN KEY-----\nabc\n-----END KEY-----'\nB=1",
+			[]kv{{"KEY", "-----BEGIN KEY-----\nabc\n-----END KEY-----", 1}, {"B", "1", 4}}},
+		{"escaped newline", "A=\"a\\\nb\"\nB=1", []kv{{"A", "a\nb", 1}, {"B", "1", 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseDotEnv(".env", tt.src)
+			if err != nil {
+				t.Fatalf("parseDotEnv() error = %v", err)
+			}
+			if got := entriesOf(entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDotEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDotEnvErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		// want are the entries parsed despite the errors
+		want []kv
+		// errors are the line and a part of the message of each error
+		errors []ParseError
+	}{
+		{"missing equals", "A=1\nFOO\nB=2", []kv{{"A", "1", 1}, {"B", "2", 3}},
+			[]ParseError{{Line: 2, Msg: `expected '=' after "FOO"`}}},
+		{"invalid name", "1A=1\n=2\nB=3", []kv{{"B", "3", 3}},
+			[]ParseError{{Line: 1, Msg: "expected variable name"}, {Line: 2, Msg: "expected variable name"}}},
+		{"text after quotes", "A=\"a\" b\nB=2", []kv{{"B", "2", 2}},
+			[]ParseError{{Line: 1, Msg: `unexpected "b" after quoted value`}}},
+		{"text after multi-line quotes", "A='a\nb' c\nB=2", []kv{{"B", "2", 3}},
+			[]ParseError{{Line: 2, Msg: `unexpected "c" after quoted value`}}},
+		{"unterminated quotes", "A=1\nB=\"abc\nC=2", []kv{{"A", "1", 1}},
+			[]ParseError{{Line: 2, Msg: "unterminated quoted value"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseDotEnv(".env", tt.src)
+			if got := entriesOf(entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDotEnv() = %+v, want %+v", got, tt.want)
+			}
+			errs := parseErrors(t, err)
+			if len(errs) != len(tt.errors) {
+				t.Fatalf("parseDotEnv() errors = %v, want %d errors", err, len(tt.errors))
+			}
+			for i, want := range tt.errors {
+				if errs[i].File != ".env" || errs[i].Line != want.Line || !strings.Contains(errs[i].Msg, want.Msg) {
+					t.Errorf("error %d = %v, want .env:%d: ...%s...", i, errs[i], want.Line, want.Msg)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDotEnvEntries(t *testing.T) {
+	src := "\ufeffA = plain # comment\r\nB=\"a \\$b ${A}\"\nC='x\ny $$'\nD= # empty\n"
+	entries, err := ParseDotEnvEntries(strings.NewReader(src), ".env")
+	if err != nil {
+		t.Fatalf("ParseDotEnvEntries() error = %v", err)
+	}
+	want := []DotEnvEntry{
+		{Key: "A", Value: "plain", Raw: "plain", Line: 1},
+		{Key: "B", Value: "a $b ${A}", Raw: `"a \$b ${A}"`, Line: 2},
+		{Key: "C", Value: "x\ny $$", Raw: "'x\ny $$'", Line: 3},
+		{Key: "D", Value: "", Raw: "", Line: 5},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ParseDotEnvEntries() = %+v, want %+v", entries, want)
+	}
+}
@@ -0,0 +1,241 @@
+package shared
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// EnvKeyVar holds the base64 encryption key of encrypted .env values.
+	EnvKeyVar = "DOTENV_KEY"
+	// EnvKeyFileVar points to a file holding the key, defaults to .env.key next to the .env file.
+	EnvKeyFileVar = "DOTENV_KEY_FILE"
+	// EnvKeyFile is the default key file name, don't commit it.
+	EnvKeyFile = ".env.key"
+
+	encryptedPrefix = "ENC[AES256_GCM,"
+	encryptedSuffix = "]"
+)
+
+// plainValue matches values that can be written without quotes.
+var plainValue = regexp.MustCompile(`^[A-Za-z0-9_./:@+=,-]*$`)
+
+// GenerateEnvKey returns a new random base64 key for EncryptValue.
+func GenerateEnvKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseEnvKey decodes a base64 AES-256 key.
+func ParseEnvKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid .env key, expected 32 base64 encoded bytes")
+	}
+	return key, nil
+}
+
+// LoadEnvKey returns the key for the encrypted .env files of dir, taken from
+// DOTENV_KEY, the file at DOTENV_KEY_FILE or dir/.env.key, in that order.
+func LoadEnvKey(dir string) ([]byte, error) {
+	if encoded := os.Getenv(EnvKeyVar); encoded != "" {
+		return ParseEnvKey(encoded)
+	}
+	path := os.Getenv(EnvKeyFileVar)
+	if path == "" {
+		path = filepath.Join(dir, EnvKeyFile)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no .env key: set %s or create %s: %w", EnvKeyVar, path, err)
+	}
+	return ParseEnvKey(string(data))
+}
+
+// IsEncrypted reports whether value was produced by EncryptValue.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix) && strings.HasSuffix(value, encryptedSuffix)
+}
+
+// EncryptValue encrypts the value of the env variable name with AES-GCM, returning ENC[AES256_GCM,...].
+// The name is authenticated, so an encrypted value can't be moved to another variable.
+func EncryptValue(key []byte, name, value string) (string, error) {
+	gcm, err := newEnvCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + encryptedSuffix, nil
+}
+
+// DecryptValue reverses EncryptValue.
+func DecryptValue(key []byte, name, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", errors.New("not an encrypted value")
+	}
+	gcm, err := newEnvCipher(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(value, encryptedPrefix), encryptedSuffix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return "", errors.New("decryption failed, wrong key?")
+	}
+	return string(plain), nil
+}
+
+func newEnvCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptEntries decrypts the encrypted values of entries in place, getKey is only called when needed.
+// Decrypted values are literal, they are not expanded.
+func decryptEntries(name string, entries []dotEnvEntry, getKey func() ([]byte, error)) error {
+	var key []byte
+	var errs []error
+	for i := range entries {
+		entry := &entries[i]
+		if !IsEncrypted(entry.Value) {
+			continue
+		}
+		if key == nil {
+			var err error
+			if key, err = getKey(); err != nil {
+				return &ParseError{File: name, Line: entry.Line, Msg: err.Error()}
+			}
+		}
+		value, err := DecryptValue(key, entry.Key, entry.Value)
+		if err != nil {
+			errs = append(errs, &ParseError{File: name, Line: entry.Line, Msg: fmt.Sprintf("%s: %v", entry.Key, err)})
+			continue
+		}
+		entry.Value, entry.Literal = value, true
+	}
+	return errors.Join(errs...)
+}
+
+// EncryptDotEnv encrypts in place the values of the .env source whose key matches,
+// comments and formatting are kept. Already encrypted values are left as they are.
+func EncryptDotEnv(src []byte, name string, key []byte, match func(key string) bool) ([]byte, error) {
+	return encryptDotEnv(src, name, key, match, nil)
+}
+
+// ReencryptDotEnv is EncryptDotEnv for an edited copy of the encrypted .env source previous: values
+// that didn't change keep their encrypted text from previous, so only edited values show up in diffs.
+func ReencryptDotEnv(src, previous []byte, name string, key []byte, match func(key string) bool) ([]byte, error) {
+	entries, err := parseDotEnv(name, string(previous))
+	if err != nil {
+		return nil, err
+	}
+	encrypted := map[string]string{}
+	for _, entry := range entries {
+		if IsEncrypted(entry.Value) {
+			encrypted[entry.Key] = entry.Value
+		}
+	}
+	return encryptDotEnv(src, name, key, match, encrypted)
+}
+
+// encryptDotEnv encrypts the matching values of src, reusing the encrypted values of previous
+// when they decrypt to the same value.
+func encryptDotEnv(src []byte, name string, key []byte, match func(key string) bool, previous map[string]string) ([]byte, error) {
+	return rewriteDotEnv(src, name, func(entry dotEnvEntry) (string, bool, error) {
+		if IsEncrypted(entry.Value) || !match(entry.Key) {
+			return "", false, nil
+		}
+		value := entry.Value
+		if !entry.Literal {
+			// Decrypted values are literal, so \$ is encrypted as $ and references can't be kept
+			var references bool
+			if value, references = unescapeDollars(value); references {
+				return "", false, fmt.Errorf("%s: ${...} isn't expanded once encrypted, escape it as \\${ or single-quote the value", entry.Key)
+			}
+		}
+		if old, ok := previous[entry.Key]; ok {
+			if decrypted, err := DecryptValue(key, entry.Key, old); err == nil && decrypted == value {
+				return old, true, nil
+			}
+		}
+		encrypted, err := EncryptValue(key, entry.Key, value)
+		return encrypted, true, err
+	})
+}
+
+// DecryptDotEnv decrypts in place the encrypted values of the .env source, comments and formatting are kept.
+// Returns the decrypted source and the decrypted keys.
+func DecryptDotEnv(src []byte, name string, key []byte) ([]byte, []string, error) {
+	var keys []string
+	out, err := rewriteDotEnv(src, name, func(entry dotEnvEntry) (string, bool, error) {
+		if !IsEncrypted(entry.Value) {
+			return "", false, nil
+		}
+		value, err := DecryptValue(key, entry.Key, entry.Value)
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", entry.Key, err)
+		}
+		keys = append(keys, entry.Key)
+		return quoteDotEnvValue(value), true, nil
+	})
+	return out, keys, err
+}
+
+// rewriteDotEnv replaces the raw values of src for which replace returns true.
+func rewriteDotEnv(src []byte, name string, replace func(dotEnvEntry) (string, bool, error)) ([]byte, error) {
+	text := normalizeDotEnv(string(src))
+	entries, err := parseDotEnv(name, text)
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, entry := range entries {
+		raw, ok, err := replace(entry)
+		if err != nil {
+			return nil, &ParseError{File: name, Line: entry.Line, Msg: err.Error()}
+		}
+		if !ok {
+			continue
+		}
+		sb.WriteString(text[last:entry.Start])
+		sb.WriteString(raw)
+		last = entry.End
+	}
+	sb.WriteString(text[last:])
+	return []byte(sb.String()), nil
+}
+
+// quoteDotEnvValue formats value so parseDotEnv reads it back literally.
+func quoteDotEnvValue(value string) string {
+	switch {
+	case plainValue.MatchString(value):
+		return value
+	case !strings.Contains(value, "'"):
+		return "'" + value + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(value) + `"`
+}
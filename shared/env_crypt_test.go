@@ -0,0 +1,156 @@
+package shared
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testEnvKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := GenerateEnvKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvKeyVar, encoded)
+	key, err := ParseEnvKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func matchAll(string) bool { return true }
+
+// loadValue returns the loaded value of A_SECRET in src, decrypted with the key of DOTENV_KEY.
+func loadValue(t *testing.T, src []byte) string {
+	t.Helper()
+	vars, err := ParseDotEnv(bytes.NewReader(src), ".env")
+	if err != nil {
+		t.Fatalf("ParseDotEnv(%q) error = %v", src, err)
+	}
+	return vars["A_SECRET"]
+}
+
+func TestEncryptDotEnvRoundTrip(t *testing.T) {
+	key := testEnvKey(t)
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"plain", `abc`, "abc"},
+		{"single quote", `"it's"`, "it's"},
+		{"single quote and escaped dollar", `"it's \$5"`, "it's $5"},
+		{"single-quoted reference", `'$5 ${HOME}'`, "$5 ${HOME}"},
+		{"dollar without braces", `"cost $5"`, "cost $5"},
+		{"escaped reference", `"\${HOME}"`, "${HOME}"},
+		{"doubled dollar", `"$${HOME}"`, "${HOME}"},
+		{"double quotes", `'say "hi"'`, `say "hi"`},
+		{"everything", `"it's \"$\" \\ \$"`, `it's "$" \ $`},
+		{"escaped newline", `"a\nb"`, "a\nb"},
+		{"multi-line", "\"it's\n$HOME\"", "it's\n$HOME"},
+		{"spaces and tab", `" a\tb "`, " a\tb "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := []byte("# comment\nA_SECRET=" + tt.value + " # trailing\nOTHER=1\n")
+			encrypted, err := EncryptDotEnv(src, ".env", key, matchAll)
+			if err != nil {
+				t.Fatalf("EncryptDotEnv() error = %v", err)
+			}
+			if got := loadValue(t, encrypted); got != tt.want {
+				t.Errorf("encrypted value = %q, want %q", got, tt.want)
+			}
+
+			decrypted, keys, err := DecryptDotEnv(encrypted, ".env", key)
+			if err != nil {
+				t.Fatalf("DecryptDotEnv() error = %v", err)
+			}
+			if len(keys) != 2 || !strings.HasPrefix(string(decrypted), "# comment\nA_SECRET=") || !strings.HasSuffix(string(decrypted), " # trailing\nOTHER=1\n") {
+				t.Errorf("DecryptDotEnv() = %q, %v", decrypted, keys)
+			}
+			if got := loadValue(t, decrypted); got != tt.want {
+				t.Errorf("decrypted value = %q, want %q", got, tt.want)
+			}
+
+			// What envcrypt edit does with an unchanged file
+			reencrypted, err := ReencryptDotEnv(decrypted, encrypted, ".env", key, matchAll)
+			if err != nil {
+				t.Fatalf("ReencryptDotEnv() error = %v", err)
+			}
+			if !bytes.Equal(reencrypted, encrypted) {
+				t.Errorf("ReencryptDotEnv() = %q, want the unchanged %q", reencrypted, encrypted)
+			}
+			encrypted, err = EncryptDotEnv(decrypted, ".env", key, matchAll)
+			if err != nil {
+				t.Fatalf("EncryptDotEnv() of the decrypted file error = %v", err)
+			}
+			if got := loadValue(t, encrypted); got != tt.want {
+				t.Errorf("encrypted again value = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptDotEnvReferences(t *testing.T) {
+	key := testEnvKey(t)
+	for _, value := range []string{`${HOME}`, `"it's ${HOME}"`, `"a ${HOME:-x}"`} {
+		if _, err := EncryptDotEnv([]byte("A_SECRET="+value), ".env", key, matchAll); err == nil || !strings.Contains(err.Error(), "isn't expanded once encrypted") {
+			t.Errorf("EncryptDotEnv(%s) error = %v, want a reference error", value, err)
+		}
+	}
+}
+
+func TestReencryptDotEnv(t *testing.T) {
+	key := testEnvKey(t)
+	previous, err := EncryptDotEnv([]byte("A_SECRET=a\nB_SECRET=b\n"), ".env", key, matchAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := strings.Split(string(previous), "\n")
+
+	reencrypted, err := ReencryptDotEnv([]byte("A_SECRET=a\nB_SECRET=changed\nC_SECRET=new\n"), previous, ".env", key, matchAll)
+	if err != nil {
+		t.Fatalf("ReencryptDotEnv() error = %v", err)
+	}
+	after := strings.Split(string(reencrypted), "\n")
+	if after[0] != before[0] {
+		t.Errorf("unchanged A_SECRET = %q, want %q", after[0], before[0])
+	}
+	if after[1] == before[1] || !IsEncrypted(strings.TrimPrefix(after[1], "B_SECRET=")) {
+		t.Errorf("changed B_SECRET = %q, want it encrypted again", after[1])
+	}
+	vars, err := ParseDotEnv(bytes.NewReader(reencrypted), ".env")
+	if err != nil || vars["A_SECRET"] != "a" || vars["B_SECRET"] != "changed" || vars["C_SECRET"] != "new" {
+		t.Errorf("ParseDotEnv() = %v, %v", vars, err)
+	}
+}
+
+func TestDecryptValueErrors(t *testing.T) {
+	key := testEnvKey(t)
+	encrypted, err := EncryptValue(key, "A_SECRET", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _ := GenerateEnvKey()
+	other, _ := ParseEnvKey(otherKey)
+	tests := []struct {
+		name     string
+		key      []byte
+		variable string
+		value    string
+	}{
+		{"wrong key", other, "A_SECRET", encrypted},
+		{"moved to another variable", key, "B_SECRET", encrypted},
+		{"not encrypted", key, "A_SECRET", "value"},
+		{"malformed", key, "A_SECRET", "ENC[AES256_GCM,%%%]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if value, err := DecryptValue(tt.key, tt.variable, tt.value); err == nil {
+				t.Errorf("DecryptValue() = %q, want an error", value)
+			}
+		})
+	}
+}
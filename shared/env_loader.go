@@ -1,39 +1,145 @@
 package shared
 
 import (
-	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
-	"strings"
+	"path/filepath"
 )
 
-// Load properties from a .env file and set to environment
-func LoadDotEnv(path string) {
+type loadOptions struct {
+	optional bool
+	profile  string
+	override bool
+}
+
+// LoadOption customizes how ReadDotEnv and LoadEnv read .env files.
+type LoadOption func(*loadOptions)
+
+func newLoadOptions(opts []LoadOption) loadOptions {
+	var o loadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Optional treats a missing .env file as empty instead of an error,
+// useful when the variables may already be exported on the shell.
+func Optional() LoadOption {
+	return func(o *loadOptions) { o.optional = true }
+}
+
+// ParseDotEnv parses .env data from r and returns its key/values, with
+// ${VAR} references expanded against the file and the process environment.
+// Encrypted values (see EncryptValue) are decrypted with the key of LoadEnvKey.
+// name is used to report error positions, e.g. ".env:3: ...", and to find the .env.key file.
+func ParseDotEnv(r io.Reader, name string) (map[string]string, error) {
+	return parseDotEnvReader(r, name, os.LookupEnv)
+}
+
+// parseDotEnvReader is ParseDotEnv with a custom lookup for references to keys outside the file.
+func parseDotEnvReader(r io.Reader, name string, lookupEnv func(string) (string, bool)) (map[string]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	entries, err := parseDotEnv(name, string(data))
+	if err != nil {
+		return nil, err
+	}
+	getKey := func() ([]byte, error) { return LoadEnvKey(filepath.Dir(name)) }
+	if err := decryptEntries(name, entries, getKey); err != nil {
+		return nil, err
+	}
+	if err := expandDotEnv(name, entries, lookupEnv); err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		vars[entry.Key] = entry.Value
+	}
+	return vars, nil
+}
+
+// ReadDotEnv reads the .env file at path and returns its key/values
+// without touching the process environment.
+func ReadDotEnv(path string, opts ...LoadOption) (map[string]string, error) {
+	return readDotEnv(path, newLoadOptions(opts).optional, os.LookupEnv)
+}
+
+func readDotEnv(path string, optional bool, lookupEnv func(string) (string, bool)) (map[string]string, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		log.Fatalf("Error opening .env file: %v", err)
+		if optional && errors.Is(err, fs.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("opening .env file: %w", err)
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
+	return parseDotEnvReader(file, path, lookupEnv)
+}
 
-		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
-			continue
+// ApplyEnv sets every key/value on the process environment.
+func ApplyEnv(vars map[string]string) error {
+	var errs []error
+	for key, value := range vars {
+		if err := os.Setenv(key, value); err != nil {
+			errs = append(errs, fmt.Errorf("setting %s: %w", key, err))
 		}
+	}
+	return errors.Join(errs...)
+}
 
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
+// Load properties from a .env file and set to environment, replacing variables already set.
+// See parseDotEnv for the supported syntax, malformed lines are reported with their file:line position.
+// Exits the process on any error, use ReadDotEnv or LoadEnv to handle them instead.
+func LoadDotEnv(path string) {
+	vars, err := ReadDotEnv(path)
+	if err != nil {
+		log.Fatalf("Error reading .env file: %v", err)
+	}
+	if err := ApplyEnv(vars); err != nil {
+		log.Fatalf("Error setting .env values: %v", err)
+	}
+}
+
+// DotEnvEntry is a raw KEY=value assignment of a .env file.
+type DotEnvEntry struct {
+	Key string
+	// Value is unquoted and unescaped, but neither expanded nor decrypted: ${VAR} references
+	// are kept as written, Raw tells them from an escaped \${VAR}.
+	Value string
+	// Raw is the value exactly as written, quotes included
+	Raw  string
+	Line int
+}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		os.Setenv(key, value)
+// ParseDotEnvEntries returns the raw assignments of .env data in file order, duplicates included.
+// Useful for tooling, e.g. linting, use ParseDotEnv to get the final values.
+func ParseDotEnvEntries(r io.Reader, name string) ([]DotEnvEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	text := normalizeDotEnv(string(data))
+	entries, err := parseDotEnv(name, text)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("Error reading .env file: %v", err)
+	out := make([]DotEnvEntry, len(entries))
+	for i, entry := range entries {
+		value := entry.Value
+		if !entry.Literal {
+			value, _ = unescapeDollars(value)
+		}
+		out[i] = DotEnvEntry{Key: entry.Key, Value: value, Raw: text[entry.Start:entry.End], Line: entry.Line}
 	}
+	return out, nil
 }
@@ -0,0 +1,107 @@
+package shared
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+)
+
+// ProfileEnvVar selects the env profile when no explicit profile is given.
+const ProfileEnvVar = "APP_ENV"
+
+// WithProfile selects the profile loaded by LoadEnv, e.g. "sandbox" loads .env.sandbox.
+// An empty profile falls back to APP_ENV.
+func WithProfile(profile string) LoadOption {
+	return func(o *loadOptions) { o.profile = profile }
+}
+
+// OverrideEnv makes LoadEnv replace variables already set on the OS environment.
+// By default, the OS environment wins over the .env files.
+func OverrideEnv() LoadOption {
+	return func(o *loadOptions) { o.override = true }
+}
+
+// ProfileFlag registers the -env flag on the default flag set, pass its value to WithProfile.
+func ProfileFlag() *string {
+	return flag.String("env", "", "env profile, loads .env.<profile> (default $"+ProfileEnvVar+")")
+}
+
+// EnvFiles returns the files read by LoadEnv for profile, in precedence order (later wins).
+func EnvFiles(dir, profile string) []string {
+	files := []string{filepath.Join(dir, ".env")}
+	if profile != "" {
+		files = append(files, filepath.Join(dir, ".env."+profile))
+	}
+	return append(files, filepath.Join(dir, ".env.local"))
+}
+
+// LoadEnv reads the layered env files of dir and sets them on the environment:
+//  1. .env
+//  2. .env.<profile>, where profile comes from WithProfile, APP_ENV on the OS environment or APP_ENV on .env
+//  3. .env.local, for personal overrides that shouldn't be committed
+//
+// Later files override earlier ones and can reference their keys with ${VAR}.
+// .env and .env.local are optional, the profile file is required once a profile is selected.
+// Variables already set on the OS environment are kept unless OverrideEnv is given.
+//
+// Returns the resulting value of every key found on the files.
+func LoadEnv(dir string, opts ...LoadOption) (map[string]string, error) {
+	vars, _, err := readEnvLayers(dir, newLoadOptions(opts), os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range vars {
+		if err := os.Setenv(key, value); err != nil {
+			return nil, fmt.Errorf("setting %s: %w", key, err)
+		}
+	}
+	return vars, nil
+}
+
+// readEnvLayers returns the resulting value of every key of the env files of dir and the files read.
+// lookupOS returns the variables set on the OS environment, outside of the env files.
+func readEnvLayers(dir string, o loadOptions, lookupOS func(string) (string, bool)) (map[string]string, []string, error) {
+	merged := map[string]string{}
+	// References resolve to the value each key will end up having
+	lookupEnv := func(key string) (string, bool) {
+		if value, ok := lookupOS(key); ok && !o.override {
+			return value, true
+		}
+		if value, ok := merged[key]; ok {
+			return value, true
+		}
+		return lookupOS(key)
+	}
+
+	base, err := readDotEnv(filepath.Join(dir, ".env"), true, lookupEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+	maps.Copy(merged, base)
+
+	profile := o.profile
+	if profile == "" {
+		profile, _ = lookupEnv(ProfileEnvVar)
+	}
+	files := EnvFiles(dir, profile)
+	for i, path := range files[1:] {
+		// The profile file (if any) is the only required one
+		optional := profile == "" || i > 0
+		vars, err := readDotEnv(path, optional, lookupEnv)
+		if err != nil {
+			return nil, nil, err
+		}
+		maps.Copy(merged, vars)
+	}
+
+	if !o.override {
+		for key := range merged {
+			if current, ok := lookupOS(key); ok {
+				merged[key] = current
+			}
+		}
+	}
+	return merged, files, nil
+}
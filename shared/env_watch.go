@@ -0,0 +1,226 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvChange is a key whose value changed after a reload.
+type EnvChange struct {
+	Key      string
+	Old, New string
+	// Added and Removed are set when the key is new or no longer on the env files
+	Added, Removed bool
+}
+
+// String redacts the values of secret keys, see IsSecretKey.
+func (c EnvChange) String() string {
+	before, after := any(c.Old), any(c.New)
+	if IsSecretKey(c.Key) {
+		before, after = NewSecret(c.Old), NewSecret(c.New)
+	}
+	switch {
+	case c.Added:
+		return fmt.Sprintf("+%s=%v", c.Key, after)
+	case c.Removed:
+		return fmt.Sprintf("-%s", c.Key)
+	}
+	return fmt.Sprintf("%s: %v -> %v", c.Key, before, after)
+}
+
+// EnvWatcher reloads the layered env files of LoadEnv when they change, and
+// notifies the changed keys to the registered callbacks.
+type EnvWatcher struct {
+	dir  string
+	opts loadOptions
+	// osEnv is the environment before loading the files, to tell our own values apart
+	osEnv map[string]string
+
+	// reloadMu serializes reloads, so callbacks get the changes in order
+	reloadMu  sync.Mutex
+	mu        sync.Mutex
+	values    map[string]string
+	files     []string
+	stamps    map[string]fileStamp
+	callbacks []func([]EnvChange)
+	onError   func(error)
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// WatchEnv loads the env files of dir like LoadEnv and checks them every interval until ctx is done.
+//
+//	watcher, err := shared.WatchEnv(ctx, "..", 2*time.Second)
+//	watcher.OnChange(func(changes []shared.EnvChange) {
+//		slog.Info("🔄 .env changed", "changes", changes)
+//		// Bind the config again and swap the API clients
+//	})
+func WatchEnv(ctx context.Context, dir string, interval time.Duration, opts ...LoadOption) (*EnvWatcher, error) {
+	w := &EnvWatcher{
+		dir:   dir,
+		opts:  newLoadOptions(opts),
+		osEnv: environ(),
+		onError: func(err error) {
+			slog.Error("Reloading env failed", "error", err)
+		},
+	}
+	if _, err := w.Reload(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !w.modified() {
+					continue
+				}
+				if _, err := w.Reload(); err != nil {
+					w.mu.Lock()
+					onError := w.onError
+					w.mu.Unlock()
+					onError(err)
+				}
+			}
+		}
+	}()
+	return w, nil
+}
+
+// OnChange registers fn to be called, from the watcher goroutine, with the keys changed on every reload.
+// fn must not call Reload.
+func (w *EnvWatcher) OnChange(fn func([]EnvChange)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callbacks = append(w.callbacks, fn)
+}
+
+// OnError replaces the handler of reload errors, by default they are logged.
+// The previous values are kept when a reload fails.
+func (w *EnvWatcher) OnError(fn func(error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onError = fn
+}
+
+// Values returns a copy of the current values.
+func (w *EnvWatcher) Values() map[string]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return maps.Clone(w.values)
+}
+
+// Reload reads the env files now, updates the environment and notifies the changes, if any.
+func (w *EnvWatcher) Reload() ([]EnvChange, error) {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	w.mu.Lock()
+	// Stamp before reading, so edits made while reading trigger another reload
+	stamps := w.stampFiles(w.files)
+	values, files, err := readEnvLayers(w.dir, w.opts, func(key string) (string, bool) {
+		value, ok := w.osEnv[key]
+		return value, ok
+	})
+	if err != nil {
+		w.stamps = stamps
+		w.mu.Unlock()
+		return nil, err
+	}
+	if !slices.Equal(files, w.files) {
+		stamps = w.stampFiles(files)
+	}
+
+	changes := diffEnv(w.values, values)
+	for _, change := range changes {
+		if change.Removed {
+			// Back to the OS value, if any
+			if value, external := w.osEnv[change.Key]; external {
+				os.Setenv(change.Key, value)
+			} else {
+				os.Unsetenv(change.Key)
+			}
+			continue
+		}
+		if err := os.Setenv(change.Key, change.New); err != nil {
+			w.mu.Unlock()
+			return nil, fmt.Errorf("setting %s: %w", change.Key, err)
+		}
+	}
+	initial := w.values == nil
+	w.values, w.files, w.stamps = values, files, stamps
+	callbacks := slices.Clone(w.callbacks)
+	w.mu.Unlock()
+
+	if !initial && len(changes) > 0 {
+		for _, fn := range callbacks {
+			fn(changes)
+		}
+	}
+	return changes, nil
+}
+
+// modified reports whether any of the watched files changed since the last reload.
+func (w *EnvWatcher) modified() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !maps.Equal(w.stamps, w.stampFiles(w.files))
+}
+
+func (w *EnvWatcher) stampFiles(files []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(files))
+	for _, path := range files {
+		// Missing files get the zero stamp, so creating them is a change too
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		} else {
+			stamps[path] = fileStamp{}
+		}
+	}
+	return stamps
+}
+
+// diffEnv returns the changes from before to after, sorted by key.
+func diffEnv(before, after map[string]string) []EnvChange {
+	var changes []EnvChange
+	for key, value := range after {
+		previous, ok := before[key]
+		switch {
+		case !ok:
+			changes = append(changes, EnvChange{Key: key, New: value, Added: true})
+		case previous != value:
+			changes = append(changes, EnvChange{Key: key, Old: previous, New: value})
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			changes = append(changes, EnvChange{Key: key, Old: value, Removed: true})
+		}
+	}
+	slices.SortFunc(changes, func(a, b EnvChange) int { return strings.Compare(a.Key, b.Key) })
+	return changes
+}
+
+func environ() map[string]string {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			env[key] = value
+		}
+	}
+	return env
+}
@@ -0,0 +1,367 @@
+// Package faults injects latency, errors, truncated bodies, dropped connections and slow responses,
+// to test how clients behave on slow or flaky networks. Rules come from the JSON file of FAULTS_FILE,
+// and can be changed at runtime on /admin/faults when FAULTS_ADMIN is true:
+//
+//	{"rules": [
+//	  {"match": "POST /v2/checkout/orders", "error_percent": 30, "error_status": 503},
+//	  {"match": "GET /users/*", "latency": "500ms", "latency_jitter": "1s"},
+//	  {"match": "/v2/**", "drip_bytes": 16, "drip_interval": "200ms"}
+//	]}
+//
+// The first rule matching a request applies, and every fault of a rule applies independently.
+package faults
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	// Local
+	"local/shared/metrics"
+	"local/shared/problem"
+)
+
+// AdminPath serves the rules, faults never apply to it.
+const AdminPath = "/admin/faults"
+
+const (
+	// FileEnvVar is the JSON file of the rules, none by default.
+	FileEnvVar = "FAULTS_FILE"
+	// AdminEnvVar serves AdminPath when true, off by default.
+	AdminEnvVar = "FAULTS_ADMIN"
+)
+
+// HeaderFault names the faults injected on a response.
+const HeaderFault = "X-Fault"
+
+// Fault names, of HeaderFault and the metrics.
+const (
+	FaultLatency  = "latency"
+	FaultError    = "error"
+	FaultDrop     = "drop"
+	FaultTruncate = "truncate"
+	FaultDrip     = "drip"
+)
+
+var injectedTotal = metrics.NewCounter("faults_injected_total", "Faults injected in HTTP responses.", "fault")
+
+// Duration is a time.Duration written like "300ms" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	*d = Duration(parsed)
+	return err
+}
+
+// Rule are the faults of the requests it matches. Percentages are from 0 to 100.
+type Rule struct {
+	// Match is "METHOD /path" or "/path", with path.Match patterns like /users/* and a trailing
+	// ** matching any suffix, e.g. /v2/**. Every request matches when empty.
+	Match string `json:"match,omitempty"`
+
+	// Latency delays the response, plus a random delay up to LatencyJitter
+	Latency       Duration `json:"latency,omitempty"`
+	LatencyJitter Duration `json:"latency_jitter,omitempty"`
+
+	// ErrorPercent of the responses are an ErrorStatus problem, 503 by default
+	ErrorPercent float64 `json:"error_percent,omitempty"`
+	ErrorStatus  int     `json:"error_status,omitempty"`
+
+	// DropPercent of the connections are closed without a response
+	DropPercent float64 `json:"drop_percent,omitempty"`
+
+	// TruncatePercent of the responses are cut in half, then the connection is closed
+	TruncatePercent float64 `json:"truncate_percent,omitempty"`
+
+	// DripBytes of the body are sent every DripInterval
+	DripBytes    int      `json:"drip_bytes,omitempty"`
+	DripInterval Duration `json:"drip_interval,omitempty"`
+}
+
+// Config is the content of the rules file and the admin endpoint.
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Validate checks the rules.
+func (c *Config) Validate() error {
+	var errs []error
+	for i, rule := range c.Rules {
+		if _, _, err := parseMatch(rule.Match); err != nil {
+			errs = append(errs, fmt.Errorf("rule %d: %w", i, err))
+		}
+		if !percent(rule.ErrorPercent) || !percent(rule.DropPercent) || !percent(rule.TruncatePercent) {
+			errs = append(errs, fmt.Errorf("rule %d: percentages must be from 0 to 100", i))
+		}
+		if rule.ErrorStatus != 0 && (rule.ErrorStatus < 400 || rule.ErrorStatus > 599) {
+			errs = append(errs, fmt.Errorf("rule %d: error_status must be from 400 to 599", i))
+		}
+		if rule.Latency < 0 || rule.LatencyJitter < 0 || rule.DripBytes < 0 || rule.DripInterval < 0 {
+			errs = append(errs, fmt.Errorf("rule %d: negative latency or drip", i))
+		}
+		if (rule.DripBytes > 0) != (rule.DripInterval > 0) {
+			errs = append(errs, fmt.Errorf("rule %d: drip_bytes and drip_interval go together", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func percent(p float64) bool {
+	return p >= 0 && p <= 100
+}
+
+func parseMatch(match string) (method, pattern string, err error) {
+	method, pattern, ok := strings.Cut(match, " ")
+	if !ok {
+		method, pattern = "", match
+	}
+	if pattern == "" {
+		return method, "", nil
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		return "", "", fmt.Errorf("match %q: path must start with /", match)
+	}
+	if _, err := path.Match(strings.TrimSuffix(pattern, "**"), ""); err != nil {
+		return "", "", fmt.Errorf("match %q: %w", match, err)
+	}
+	return method, pattern, nil
+}
+
+func (rule *Rule) matches(r *http.Request) bool {
+	method, pattern, _ := parseMatch(rule.Match)
+	if method != "" && method != r.Method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "**"); ok {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	}
+	matched, _ := path.Match(pattern, r.URL.Path)
+	return pattern == "" || matched
+}
+
+// Injector applies the rules of a Config.
+type Injector struct {
+	config atomic.Pointer[Config]
+}
+
+// NewInjector creates an Injector without rules, which doesn't inject anything.
+func NewInjector() *Injector {
+	i := &Injector{}
+	i.config.Store(&Config{Rules: []Rule{}})
+	return i
+}
+
+// Default is the injector of the package functions, used by middleware.Default.
+var Default = NewInjector()
+
+// Setup loads the rules of the FAULTS_FILE file, if set, into Default, and serves them on mux,
+// or http.DefaultServeMux when nil, if FAULTS_ADMIN is true. See Injector.Handle.
+func Setup(mux *http.ServeMux) error {
+	if file := os.Getenv(FileEnvVar); file != "" {
+		if err := Default.Load(file); err != nil {
+			return err
+		}
+		slog.Warn("💥 Injecting faults", "file", file, "rules", len(Default.Config().Rules))
+	}
+	if env := os.Getenv(AdminEnvVar); env != "" {
+		admin, err := strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("%s: %w", AdminEnvVar, err)
+		}
+		if admin {
+			Default.Handle(mux)
+			slog.Warn("💥 Fault rules can be changed from localhost", "path", AdminPath)
+		}
+	}
+	return nil
+}
+
+// Config returns the current rules.
+func (i *Injector) Config() *Config {
+	return i.config.Load()
+}
+
+// Set replaces the rules.
+func (i *Injector) Set(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if config.Rules == nil {
+		config.Rules = []Rule{}
+	}
+	i.config.Store(config)
+	return nil
+}
+
+// Load replaces the rules with the ones of the JSON file at path.
+func (i *Injector) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := i.Set(&config); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// rule returns the rule of r, nil when none matches.
+func (i *Injector) rule(r *http.Request) *Rule {
+	if r.URL.Path == AdminPath {
+		return nil
+	}
+	config := i.config.Load()
+	for k := range config.Rules {
+		if config.Rules[k].matches(r) {
+			return &config.Rules[k]
+		}
+	}
+	return nil
+}
+
+func chance(percent float64) bool {
+	return percent > 0 && rand.Float64()*100 < percent
+}
+
+// Middleware injects the faults of the rule matching each request.
+func (i *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule := i.rule(r)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var injected []string
+		inject := func(fault string) {
+			injected = append(injected, fault)
+			injectedTotal.With(fault).Inc()
+			w.Header().Set(HeaderFault, strings.Join(injected, ","))
+		}
+
+		if delay := time.Duration(rule.Latency); delay > 0 || rule.LatencyJitter > 0 {
+			if rule.LatencyJitter > 0 {
+				delay += rand.N(time.Duration(rule.LatencyJitter))
+			}
+			inject(FaultLatency)
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if chance(rule.DropPercent) {
+			inject(FaultDrop)
+			slog.WarnContext(r.Context(), "💥 Dropping the connection")
+			// The server closes the connection, see middleware.Recover
+			panic(http.ErrAbortHandler)
+		}
+		if chance(rule.ErrorPercent) {
+			inject(FaultError)
+			status := rule.ErrorStatus
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			slog.WarnContext(r.Context(), "💥 Injecting an error", "status", status)
+			problem.Write(w, r, problem.New(status, problem.TypeBlank, "injected fault"))
+			return
+		}
+
+		truncate := chance(rule.TruncatePercent)
+		drip := rule.DripBytes > 0
+		if !truncate && !drip {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The response is buffered, then sent truncated or drop by drop
+		buf := &bufferedWriter{header: http.Header{}}
+		next.ServeHTTP(buf, r)
+		for name, values := range buf.header {
+			w.Header()[name] = values
+		}
+		body := buf.body.Bytes()
+		if truncate {
+			inject(FaultTruncate)
+			slog.WarnContext(r.Context(), "💥 Truncating the response", "bytes", len(body)/2, "of", len(body))
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			body = body[:len(body)/2]
+		}
+		if drip {
+			inject(FaultDrip)
+		}
+		w.WriteHeader(max(buf.status, http.StatusOK))
+
+		chunk := len(body)
+		if drip {
+			chunk = rule.DripBytes
+		}
+		flusher, _ := w.(http.Flusher)
+		for len(body) > 0 {
+			n := min(chunk, len(body))
+			if _, err := w.Write(body[:n]); err != nil {
+				return
+			}
+			body = body[n:]
+			if flusher != nil {
+				flusher.Flush()
+			}
+			if drip && len(body) > 0 {
+				select {
+				case <-time.After(time.Duration(rule.DripInterval)):
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}
+		if truncate {
+			// Closes the connection before the declared Content-Length
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// bufferedWriter buffers a response.
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) Header() http.Header { return w.header }
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
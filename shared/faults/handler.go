@@ -0,0 +1,66 @@
+package faults
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+
+	// Local
+	"local/shared/problem"
+)
+
+// Handle serves the rules on mux, or http.DefaultServeMux when nil:
+//
+//	curl localhost:8080/admin/faults
+//	curl -X PUT -d '{"rules": [{"match": "GET /users/*", "error_percent": 50}]}' localhost:8080/admin/faults
+//	curl -X DELETE localhost:8080/admin/faults
+//
+// There's no authentication, only clients on a loopback address are allowed.
+func (i *Injector) Handle(mux *http.ServeMux) {
+	if mux == nil {
+		mux = http.DefaultServeMux
+	}
+	mux.HandleFunc("GET "+AdminPath, loopbackOnly(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, i.Config())
+	}))
+	mux.HandleFunc("PUT "+AdminPath, loopbackOnly(func(w http.ResponseWriter, r *http.Request) {
+		var config Config
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			problem.Write(w, r, problem.InvalidBody(err))
+			return
+		}
+		if err := i.Set(&config); err != nil {
+			problem.Write(w, r, problem.BadRequest("%v", err))
+			return
+		}
+		slog.WarnContext(r.Context(), "💥 Fault rules changed", "rules", len(config.Rules))
+		writeJSON(w, i.Config())
+	}))
+	mux.HandleFunc("DELETE "+AdminPath, loopbackOnly(func(w http.ResponseWriter, r *http.Request) {
+		i.Set(&Config{})
+		slog.InfoContext(r.Context(), "Fault rules cleared")
+		writeJSON(w, i.Config())
+	}))
+}
+
+// loopbackOnly answers 403 to clients not on a loopback address.
+func loopbackOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if addr, err := netip.ParseAddr(host); err != nil || !addr.Unmap().IsLoopback() {
+			slog.WarnContext(r.Context(), "⛔ Fault rules requested from a remote address", "remote_addr", r.RemoteAddr)
+			problem.Write(w, r, problem.Forbidden("fault rules can only be read and changed from localhost"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,40 @@
+package health
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+)
+
+// CertificateCheck checks that the first certificate of the PEM file certFile is valid now
+// and for at least minValidity more, e.g. 24h to get warned before it expires.
+func CertificateCheck(certFile string, minValidity time.Duration) Check {
+	return func(context.Context) error {
+		data, err := os.ReadFile(certFile)
+		if err != nil {
+			return err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "CERTIFICATE" {
+			return fmt.Errorf("%s: no PEM certificate", certFile)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", certFile, err)
+		}
+
+		now := time.Now()
+		switch {
+		case now.Before(cert.NotBefore):
+			return fmt.Errorf("%s: not valid before %s", certFile, cert.NotBefore.Format(time.RFC3339))
+		case now.After(cert.NotAfter):
+			return fmt.Errorf("%s: expired on %s", certFile, cert.NotAfter.Format(time.RFC3339))
+		case now.Add(minValidity).After(cert.NotAfter):
+			return fmt.Errorf("%s: expires on %s", certFile, cert.NotAfter.Format(time.RFC3339))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,180 @@
+// Package health serves /healthz (liveness) and /readyz (readiness) with pluggable checks:
+//
+//	health.Add("stripe", func(ctx context.Context) error { ... })
+//	health.Handle(nil) // on http.DefaultServeMux
+//
+//	until curl -sf localhost:8080/readyz; do sleep 1; done
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Check returns nil when a dependency is ready.
+type Check func(ctx context.Context) error
+
+// DefaultTimeout bounds every check.
+const DefaultTimeout = 2 * time.Second
+
+// Status values of reports.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Checker runs the readiness checks.
+type Checker struct {
+	mu      sync.Mutex
+	names   []string
+	checks  map[string]Check
+	timeout time.Duration
+}
+
+// NewChecker creates a checker without checks, which is always ready.
+func NewChecker() *Checker {
+	return &Checker{checks: map[string]Check{}, timeout: DefaultTimeout}
+}
+
+// Default is the checker of the package functions.
+var Default = NewChecker()
+
+// Add adds a check to Default, see Checker.Add.
+func Add(name string, check Check) { Default.Add(name, check) }
+
+// Handle serves Default on mux, see Checker.Handle.
+func Handle(mux *http.ServeMux) { Default.Handle(mux) }
+
+// Add adds a check, replacing the one with the same name if any.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ms"`
+}
+
+// MarshalJSON writes the duration in milliseconds.
+func (r Result) MarshalJSON() ([]byte, error) {
+	type plain Result
+	p := plain(r)
+	p.Duration = r.Duration.Round(time.Millisecond) / time.Millisecond
+	return json.Marshal(p)
+}
+
+// Report is the outcome of all the checks.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Ready reports whether every check passed.
+func (r Report) Ready() bool { return r.Status == StatusOK }
+
+// Check runs all the checks concurrently, each one with a timeout.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	names := slices.Clone(c.names)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	timeout := c.timeout
+	c.mu.Unlock()
+
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, check, timeout)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, check Check, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("check panicked: %v", p)
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	result := Result{Status: StatusOK}
+	select {
+	case err := <-done:
+		if err != nil {
+			result = Result{Status: StatusUnavailable, Error: err.Error()}
+		}
+	case <-ctx.Done():
+		result = Result{Status: StatusUnavailable, Error: fmt.Sprintf("timed out after %s", timeout)}
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// LivenessHandler always answers 200 while the process serves requests.
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+// ReadinessHandler runs the checks and answers 200 when all of them pass, 503 otherwise.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check(r.Context())
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+// Handle registers GET /healthz and GET /readyz on mux, http.DefaultServeMux when nil.
+func (c *Checker) Handle(mux *http.ServeMux) {
+	if mux == nil {
+		mux = http.DefaultServeMux
+	}
+	mux.Handle("GET /healthz", c.LivenessHandler())
+	mux.Handle("GET /readyz", c.ReadinessHandler())
+}
+
+func writeJSON(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
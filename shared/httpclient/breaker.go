@@ -0,0 +1,166 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending the request while the circuit of its host is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerState is the state of the circuit of a host.
+type BreakerState int
+
+const (
+	// BreakerClosed lets requests through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails requests fast
+	BreakerOpen
+	// BreakerHalfOpen lets one request through to probe the host
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// breakers keeps a breaker per host.
+type breakers struct {
+	failures int
+	cooldown time.Duration
+	onChange func(host string, from, to BreakerState)
+
+	mu    sync.Mutex
+	hosts map[string]*breaker
+	now   func() time.Time
+}
+
+func newBreakers(failures int, cooldown time.Duration, onChange func(string, BreakerState, BreakerState)) *breakers {
+	return &breakers{failures: failures, cooldown: cooldown, onChange: onChange, hosts: map[string]*breaker{}, now: time.Now}
+}
+
+// allow returns ErrCircuitOpen unless a request to host may be sent.
+func (bs *breakers) allow(host string) error {
+	if bs.failures <= 0 {
+		return nil
+	}
+	bs.mu.Lock()
+	b := bs.get(host)
+	var change func()
+	switch b.state {
+	case BreakerOpen:
+		if bs.now().Sub(b.openedAt) < bs.cooldown {
+			bs.mu.Unlock()
+			return fmt.Errorf("%s: %w", host, ErrCircuitOpen)
+		}
+		change = bs.set(host, b, BreakerHalfOpen)
+		b.probing = true
+	case BreakerHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			bs.mu.Unlock()
+			return fmt.Errorf("%s: %w", host, ErrCircuitOpen)
+		}
+		b.probing = true
+	}
+	bs.mu.Unlock()
+	if change != nil {
+		change()
+	}
+	return nil
+}
+
+// record counts the outcome of an attempt to host.
+func (bs *breakers) record(host string, success bool) {
+	if bs.failures <= 0 {
+		return
+	}
+	bs.mu.Lock()
+	b := bs.get(host)
+	b.probing = false
+	var change func()
+	switch {
+	case success:
+		b.failures = 0
+		if b.state != BreakerClosed {
+			change = bs.set(host, b, BreakerClosed)
+		}
+	case b.state == BreakerHalfOpen:
+		b.openedAt = bs.now()
+		change = bs.set(host, b, BreakerOpen)
+	default:
+		b.failures++
+		if b.state == BreakerClosed && b.failures >= bs.failures {
+			b.openedAt = bs.now()
+			change = bs.set(host, b, BreakerOpen)
+		}
+	}
+	bs.mu.Unlock()
+	if change != nil {
+		change()
+	}
+}
+
+// open reports whether requests to host fail fast now.
+func (bs *breakers) open(host string) bool {
+	if bs.failures <= 0 {
+		return false
+	}
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, ok := bs.hosts[host]
+	return ok && (b.state == BreakerOpen && bs.now().Sub(b.openedAt) < bs.cooldown || b.state == BreakerHalfOpen && b.probing)
+}
+
+// release ends a probe without an outcome, e.g. canceled by the caller.
+func (bs *breakers) release(host string) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if b, ok := bs.hosts[host]; ok {
+		b.probing = false
+	}
+}
+
+// State returns the state of the circuit of host.
+func (c *Client) State(host string) BreakerState {
+	c.breakers.mu.Lock()
+	defer c.breakers.mu.Unlock()
+	if b, ok := c.breakers.hosts[host]; ok {
+		return b.state
+	}
+	return BreakerClosed
+}
+
+func (bs *breakers) get(host string) *breaker {
+	b, ok := bs.hosts[host]
+	if !ok {
+		b = &breaker{}
+		bs.hosts[host] = b
+	}
+	return b
+}
+
+// set changes the state, returning the notification to send once unlocked.
+func (bs *breakers) set(host string, b *breaker, to BreakerState) func() {
+	from := b.state
+	b.state = to
+	if bs.onChange == nil {
+		return nil
+	}
+	return func() { bs.onChange(host, from, to) }
+}
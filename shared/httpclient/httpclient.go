@@ -0,0 +1,273 @@
+// Package httpclient sends requests to other services with per attempt timeouts, retries with
+// exponential backoff and jitter, and a circuit breaker per host:
+//
+//	client := httpclient.New(httpclient.WithTimeout(10*time.Second), httpclient.WithMetrics("paypal"))
+//	res, err := client.Do(req)
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type options struct {
+	transport       http.RoundTripper
+	timeout         time.Duration
+	retries         int
+	baseDelay       time.Duration
+	maxDelay        time.Duration
+	breakerFailures int
+	breakerCooldown time.Duration
+	hooks           []Hooks
+}
+
+// Option customizes New.
+type Option func(*options)
+
+// WithTransport sends the requests through rt, http.DefaultTransport by default,
+// e.g. tracing.NewTransport(nil).
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) { o.transport = rt }
+}
+
+// WithTimeout bounds every attempt, until the response body is closed (default 10s).
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.timeout = timeout }
+}
+
+// WithRetries sets how many times a failed request is sent again (default 2), 0 disables retries.
+func WithRetries(retries int) Option {
+	return func(o *options) { o.retries = retries }
+}
+
+// WithBackoff sets the delay before the first retry (default 100ms), doubled on every retry up to max (default 2s).
+// Delays are randomized between 0 and that value (full jitter), so clients don't retry in sync.
+func WithBackoff(base, max time.Duration) Option {
+	return func(o *options) { o.baseDelay, o.maxDelay = base, max }
+}
+
+// WithBreaker opens the circuit of a host after failures consecutive failed attempts (default 5),
+// failing fast with ErrCircuitOpen for cooldown (default 30s), then lets a request through to probe it.
+// 0 failures disables the breaker.
+func WithBreaker(failures int, cooldown time.Duration) Option {
+	return func(o *options) { o.breakerFailures, o.breakerCooldown = failures, cooldown }
+}
+
+// WithHooks adds callbacks, e.g. for metrics, see WithMetrics.
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) { o.hooks = append(o.hooks, hooks) }
+}
+
+// Hooks are called on the events of a Client, nil ones are skipped.
+type Hooks struct {
+	// OnAttempt is called after every attempt, with the status code, or the error when there's no response
+	OnAttempt func(req *http.Request, attempt int, status int, err error, duration time.Duration)
+	// OnRetry is called before waiting delay to send req again
+	OnRetry func(req *http.Request, attempt int, delay time.Duration)
+	// OnBreakerChange is called when the circuit of host changes from one state to another
+	OnBreakerChange func(host string, from, to BreakerState)
+}
+
+// Client sends requests, it's safe for concurrent use.
+type Client struct {
+	opts     options
+	http     *http.Client
+	breakers *breakers
+}
+
+// New creates a Client.
+func New(opts ...Option) *Client {
+	o := options{
+		transport:       http.DefaultTransport,
+		timeout:         10 * time.Second,
+		retries:         2,
+		baseDelay:       100 * time.Millisecond,
+		maxDelay:        2 * time.Second,
+		breakerFailures: 5,
+		breakerCooldown: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// http.Client follows redirects, the timeouts are per attempt below
+	c := &Client{opts: o, http: &http.Client{Transport: o.transport}}
+	c.breakers = newBreakers(o.breakerFailures, o.breakerCooldown, func(host string, from, to BreakerState) {
+		for _, h := range c.opts.hooks {
+			if h.OnBreakerChange != nil {
+				h.OnBreakerChange(host, from, to)
+			}
+		}
+	})
+	return c
+}
+
+type idempotentKey struct{}
+
+// Idempotent marks req as safe to send again, e.g. a POST with an idempotency key header.
+// GET, HEAD, OPTIONS, TRACE, PUT and DELETE requests are idempotent already.
+func Idempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+// Do sends req. Requests are retried on 429 responses, which the server didn't process, and idempotent
+// requests on network errors and 5xx responses too, honoring Retry-After, and as long as the request
+// context isn't done. As with http.Client, the caller must close the response body.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	retries := c.opts.retries
+	// Bodies can only be sent again when they can be recreated, see http.NewRequest
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		retries = 0
+	}
+	idempotent := isIdempotent(req)
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.attempt(req, attempt)
+		// Keep the last response rather than failing fast once the circuit opened
+		if attempt >= retries || !retryable(res, err, idempotent) || req.Context().Err() != nil || c.breakers.open(req.URL.Host) {
+			return res, err
+		}
+
+		delay := c.backoff(attempt, res)
+		if res != nil {
+			// Drain so the connection is reused
+			io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+			res.Body.Close()
+		}
+		for _, h := range c.opts.hooks {
+			if h.OnRetry != nil {
+				h.OnRetry(req, attempt+1, delay)
+			}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+func (c *Client) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	host := req.URL.Host
+	if err := c.breakers.allow(host); err != nil {
+		return nil, err
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if c.opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(req.Context(), c.opts.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(req.Context())
+	}
+	start := time.Now()
+	res, err := c.http.Do(req.WithContext(ctx))
+	duration := time.Since(start)
+
+	status := 0
+	if err != nil {
+		cancel()
+		// A timeout of the attempt isn't a cancellation of the caller
+		if errors.Is(err, context.DeadlineExceeded) && req.Context().Err() == nil {
+			err = fmt.Errorf("attempt timed out after %s: %w", c.opts.timeout, err)
+		}
+	} else {
+		status = res.StatusCode
+		// The timeout covers reading the body too
+		res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	}
+	if req.Context().Err() == nil {
+		c.breakers.record(host, err == nil && status < 500 && status != http.StatusTooManyRequests)
+	} else {
+		// The caller canceling isn't a failure of the host
+		c.breakers.release(host)
+	}
+
+	for _, h := range c.opts.hooks {
+		if h.OnAttempt != nil {
+			h.OnAttempt(req, attempt, status, err, duration)
+		}
+	}
+	return res, err
+}
+
+// retryable reports whether the attempt can be sent again: a 429 always,
+// network errors and 5xx only when the request is idempotent, the server may have processed it.
+func retryable(res *http.Response, err error, idempotent bool) bool {
+	switch {
+	case err != nil:
+		return idempotent && !errors.Is(err, ErrCircuitOpen)
+	case res.StatusCode == http.StatusTooManyRequests:
+		return true
+	}
+	return idempotent && res.StatusCode >= 500 && res.StatusCode != http.StatusNotImplemented
+}
+
+// backoff returns the delay before retry attempt+1: Retry-After when the server sent it,
+// up to the max delay, or a random value up to base * 2^attempt.
+func (c *Client) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if after := retryAfter(res.Header.Get("Retry-After")); after > 0 {
+			return min(after, c.opts.maxDelay)
+		}
+	}
+	ceiling := c.opts.maxDelay
+	if attempt < 30 {
+		ceiling = min(c.opts.baseDelay<<attempt, c.opts.maxDelay)
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// retryAfter parses seconds or an HTTP date.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// cancelBody releases the attempt timeout once the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,40 @@
+package httpclient
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"local/shared/metrics"
+)
+
+var (
+	clientRequests = metrics.NewCounter("httpclient_requests_total",
+		"Outgoing HTTP attempts by client, host and status code, \"error\" when there was no response.", "client", "host", "code")
+	clientDuration = metrics.NewHistogram("httpclient_request_duration_seconds",
+		"Outgoing HTTP attempt latencies by client and host.", metrics.DefBuckets, "client", "host")
+	clientRetries = metrics.NewCounter("httpclient_retries_total",
+		"Outgoing HTTP retries by client and host.", "client", "host")
+	clientCircuit = metrics.NewGauge("httpclient_circuit_state",
+		"Circuit breaker state by client and host: 0 closed, 1 open, 2 half-open.", "client", "host")
+)
+
+// WithMetrics records the attempts, retries and breaker states on metrics.Default, labeled with name.
+func WithMetrics(name string) Option {
+	return WithHooks(Hooks{
+		OnAttempt: func(req *http.Request, _ int, status int, err error, duration time.Duration) {
+			code := "error"
+			if err == nil {
+				code = strconv.Itoa(status)
+			}
+			clientRequests.With(name, req.URL.Host, code).Inc()
+			clientDuration.With(name, req.URL.Host).Observe(duration.Seconds())
+		},
+		OnRetry: func(req *http.Request, _ int, _ time.Duration) {
+			clientRetries.With(name, req.URL.Host).Inc()
+		},
+		OnBreakerChange: func(host string, _, to BreakerState) {
+			clientCircuit.With(name, host).Set(float64(to))
+		},
+	})
+}
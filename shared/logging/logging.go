@@ -0,0 +1,120 @@
+// Package logging configures log/slog for the servers, with JSON, text or pretty console
+// output and per-request fields taken from the context.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	// LevelEnvVar selects the minimum level: debug, info (default), warn or error.
+	LevelEnvVar = "LOG_LEVEL"
+	// FormatEnvVar selects the output: pretty (default, for local development), text or json.
+	FormatEnvVar = "LOG_FORMAT"
+)
+
+// Per-request field keys.
+const (
+	KeyRequestID = "request_id"
+	KeyRoute     = "route"
+	KeyUserID    = "user_id"
+	KeyOrderID   = "order_id"
+)
+
+// RequestID returns the request ID field.
+func RequestID(id string) slog.Attr { return slog.String(KeyRequestID, id) }
+
+// Route returns the route field, e.g. "POST /create-order".
+func Route(route string) slog.Attr { return slog.String(KeyRoute, route) }
+
+// UserID returns the user ID field.
+func UserID(id string) slog.Attr { return slog.String(KeyUserID, id) }
+
+// OrderID returns the order ID field.
+func OrderID(id string) slog.Attr { return slog.String(KeyOrderID, id) }
+
+// Err returns an "error" field.
+func Err(err error) slog.Attr { return slog.Any("error", err) }
+
+// Setup creates the logger of service from LOG_LEVEL and LOG_FORMAT and makes it the
+// default one, so log.Printf and slog.Info go through it too.
+func Setup(service string) *slog.Logger {
+	logger := New(os.Stderr, service, os.Getenv(FormatEnvVar), os.Getenv(LevelEnvVar))
+	slog.SetDefault(logger)
+	return logger
+}
+
+// New creates a logger writing to w, see Setup.
+func New(w io.Writer, service, format, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(level)}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts).WithAttrs([]slog.Attr{slog.String("service", service)})
+	case "text":
+		handler = slog.NewTextHandler(w, opts).WithAttrs([]slog.Attr{slog.String("service", service)})
+	default:
+		handler = NewPrettyHandler(w, opts)
+	}
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+// ParseLevel parses debug, info, warn or error, defaulting to info.
+func ParseLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+type contextKey struct{}
+
+// With returns a copy of ctx carrying attrs, which are added to every record logged with ctx:
+//
+//	ctx := logging.With(r.Context(), logging.OrderID(orderID))
+//	slog.InfoContext(ctx, "Order captured")
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	current, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(current)+len(attrs))
+	merged = append(append(merged, current...), attrs...)
+	return context.WithValue(ctx, contextKey{}, merged)
+}
+
+// Attrs returns the fields carried by ctx.
+func Attrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	return attrs
+}
+
+// contextHandler adds the fields of With to the records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := Attrs(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// Fatal logs msg at error level with args and exits the process.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
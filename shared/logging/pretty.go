@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// PrettyHandler writes human friendly lines for local development:
+//
+//	10:53:38 ✅ INFO  Payment succeeded user_id=42 product_id=product_666
+type PrettyHandler struct {
+	w    io.Writer
+	mu   *sync.Mutex
+	opts slog.HandlerOptions
+	// ops replays WithAttrs and WithGroup calls on the attribute formatter
+	ops []func(slog.Handler) slog.Handler
+}
+
+// NewPrettyHandler creates a PrettyHandler writing to w, opts may be nil.
+func NewPrettyHandler(w io.Writer, opts *slog.HandlerOptions) *PrettyHandler {
+	h := &PrettyHandler{w: w, mu: &sync.Mutex{}}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+func (h *PrettyHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *PrettyHandler) Handle(ctx context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	buf.WriteString(r.Time.Format("15:04:05"))
+	buf.WriteByte(' ')
+	buf.WriteString(levelEmoji(r.Level))
+	buf.WriteByte(' ')
+	buf.WriteString((r.Level.String() + "  ")[:5])
+	buf.WriteByte(' ')
+	buf.WriteString(r.Message)
+
+	// Attributes are formatted by a TextHandler, which handles groups, quoting and slog.LogValuer
+	var attrs bytes.Buffer
+	var formatter slog.Handler = slog.NewTextHandler(&attrs, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey || a.Key == slog.MessageKey) {
+				return slog.Attr{}
+			}
+			if h.opts.ReplaceAttr != nil {
+				return h.opts.ReplaceAttr(groups, a)
+			}
+			return a
+		},
+	})
+	for _, op := range h.ops {
+		formatter = op(formatter)
+	}
+	if err := formatter.Handle(ctx, r); err != nil {
+		return err
+	}
+	if attrs.Len() > 1 {
+		buf.WriteByte(' ')
+		buf.Write(attrs.Bytes())
+	} else {
+		buf.WriteByte('\n')
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *PrettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *PrettyHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *PrettyHandler) with(op func(slog.Handler) slog.Handler) *PrettyHandler {
+	clone := *h
+	clone.ops = append(clone.ops[:len(clone.ops):len(clone.ops)], op)
+	return &clone
+}
+
+func levelEmoji(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "‼️"
+	case level >= slog.LevelWarn:
+		return "⚠️"
+	case level >= slog.LevelInfo:
+		return "✅"
+	}
+	return "🔍"
+}
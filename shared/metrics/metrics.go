@@ -0,0 +1,181 @@
+// Package metrics implements counters, gauges and histograms exposed on /metrics in the
+// Prometheus text format, without external dependencies:
+//
+//	var orders = metrics.NewCounter("paypal_orders_total", "PayPal orders by result.", "result")
+//
+//	orders.With("created").Inc()
+//	http.Handle("GET /metrics", metrics.Handler())
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are the default histogram buckets, in seconds, fit for request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var validName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// family is a metric with all its label combinations.
+type family struct {
+	name, help string
+	typ        metricType
+	labels     []string
+	buckets    []float64
+	// fn computes the value of GaugeFunc families when scraped
+	fn func() float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series is a label combination of a family.
+type series struct {
+	labelValues []string
+	// value holds the float64 bits of counters and gauges
+	value atomic.Uint64
+
+	mu     sync.Mutex // guards the histogram fields
+	counts []uint64   // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values (%s), got %d",
+			f.name, len(f.labels), strings.Join(f.labels, ", "), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(values)}
+		if f.typ == histogramType {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (s *series) add(delta float64) {
+	for {
+		old := s.value.Load()
+		if s.value.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (s *series) load() float64 { return math.Float64frombits(s.value.Load()) }
+
+// Counter only goes up, e.g. requests served.
+type Counter struct {
+	family *family
+	series *series
+}
+
+// With returns the counter of the label values, in the order of the labels it was created with.
+func (c *Counter) With(labelValues ...string) *Counter {
+	return &Counter{family: c.family, series: c.family.with(labelValues)}
+}
+
+// Inc adds 1.
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add adds delta, which must not be negative.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't decrease", c.family.name))
+	}
+	c.get().add(delta)
+}
+
+// Value returns the current value.
+func (c *Counter) Value() float64 { return c.get().load() }
+
+func (c *Counter) get() *series {
+	if c.series == nil {
+		return c.family.with(nil)
+	}
+	return c.series
+}
+
+// Gauge goes up and down, e.g. requests in flight.
+type Gauge struct {
+	family *family
+	series *series
+}
+
+// With returns the gauge of the label values.
+func (g *Gauge) With(labelValues ...string) *Gauge {
+	return &Gauge{family: g.family, series: g.family.with(labelValues)}
+}
+
+// Set sets the value.
+func (g *Gauge) Set(value float64) { g.get().value.Store(math.Float64bits(value)) }
+
+// Inc adds 1.
+func (g *Gauge) Inc() { g.Add(1) }
+
+// Dec subtracts 1.
+func (g *Gauge) Dec() { g.Add(-1) }
+
+// Add adds delta, which may be negative.
+func (g *Gauge) Add(delta float64) { g.get().add(delta) }
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 { return g.get().load() }
+
+func (g *Gauge) get() *series {
+	if g.series == nil {
+		return g.family.with(nil)
+	}
+	return g.series
+}
+
+// Histogram counts observations, e.g. latencies, in buckets.
+type Histogram struct {
+	family *family
+	series *series
+}
+
+// With returns the histogram of the label values.
+func (h *Histogram) With(labelValues ...string) *Histogram {
+	return &Histogram{family: h.family, series: h.family.with(labelValues)}
+}
+
+// Observe records value.
+func (h *Histogram) Observe(value float64) {
+	s := h.series
+	if s == nil {
+		s = h.family.with(nil)
+	}
+	// Buckets are upper bounds, value goes in the first one that fits, if any
+	i, _ := slices.BinarySearch(h.family.buckets, value)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds the metrics exposed by a handler.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry, most code uses Default instead.
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// Default is the registry of the package functions and Handler.
+var Default = NewRegistry()
+
+// NewCounter registers a counter on Default, see Registry.NewCounter.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewGauge registers a gauge on Default, see Registry.NewGauge.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewGaugeFunc registers a gauge on Default, see Registry.NewGaugeFunc.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.NewGaugeFunc(name, help, fn)
+}
+
+// NewHistogram registers a histogram on Default, see Registry.NewHistogram.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// Handler serves the metrics of Default.
+func Handler() http.Handler { return Default.Handler() }
+
+// NewCounter registers a counter, by convention named with a _total suffix.
+// Registering the same name again returns the same counter.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{family: r.register(name, help, counterType, labels, nil, nil)}
+}
+
+// NewGauge registers a gauge.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{family: r.register(name, help, gaugeType, labels, nil, nil)}
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by fn on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, help, gaugeType, nil, nil, fn)
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds, DefBuckets when nil.
+// By convention it's named after its unit, e.g. http_request_duration_seconds.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return &Histogram{family: r.register(name, help, histogramType, labels, slices.Compact(buckets), nil)}
+}
+
+func (r *Registry) register(name, help string, typ metricType, labels []string, buckets []float64, fn func() float64) *family {
+	if !validName.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid name %q", name))
+	}
+	for _, label := range labels {
+		if !validName.MatchString(label) || strings.HasPrefix(label, "__") || label == "le" {
+			panic(fmt.Sprintf("metrics: invalid label %q of %s", label, name))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.typ != typ || !slices.Equal(f.labels, labels) || fn != nil {
+			panic(fmt.Sprintf("metrics: %s registered already with another type or labels", name))
+		}
+		return f
+	}
+	f := &family{
+		name: name, help: help, typ: typ,
+		labels: slices.Clone(labels), buckets: buckets, fn: fn,
+		series: map[string]*series{},
+	}
+	r.families[name] = f
+	return f
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format, sorted by name and labels.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	slices.SortFunc(families, func(a, b *family) int { return strings.Compare(a.name, b.name) })
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(cw)
+	}
+	err := cw.w.(*bufio.Writer).Flush()
+	return cw.n, err
+}
+
+func (f *family) write(w io.Writer) {
+	if f.fn != nil {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.typ)
+		fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+		return
+	}
+
+	f.mu.Lock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mu.Unlock()
+	if len(all) == 0 {
+		return
+	}
+	slices.SortFunc(all, func(a, b *series) int { return slices.Compare(a.labelValues, b.labelValues) })
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.typ)
+	for _, s := range all {
+		labels := formatLabels(f.labels, s.labelValues)
+		if f.typ != histogramType {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, braces(labels), formatFloat(s.load()))
+			continue
+		}
+
+		s.mu.Lock()
+		counts, count, sum := slices.Clone(s.counts), s.count, s.sum
+		s.mu.Unlock()
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, braces(joinLabels(labels, `le="`+formatFloat(bound)+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, braces(joinLabels(labels, `le="+Inf"`)), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, braces(labels), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, braces(labels), count)
+	}
+}
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string   { return helpEscaper.Replace(help) }
+func escapeLabel(value string) string { return labelEscaper.Replace(value) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,19 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+func init() {
+	start := float64(time.Now().Unix())
+	NewGaugeFunc("process_start_time_seconds", "Start time of the process since unix epoch in seconds.",
+		func() float64 { return start })
+	NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.",
+		func() float64 { return float64(runtime.NumGoroutine()) })
+	NewGaugeFunc("go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.", func() float64 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return float64(stats.HeapAlloc)
+	})
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"local/shared/logging"
+)
+
+// AccessLog logs every request with its status, response size and latency,
+// at warn level for 4xx responses and error level for 5xx and aborted responses, see http.ErrAbortHandler.
+func AccessLog() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := WrapResponseWriter(w)
+			// Still logged when the response is aborted, e.g. a dropped connection of package faults
+			aborted := true
+			defer func() {
+				level := slog.LevelInfo
+				switch status := rw.Status(); {
+				case aborted || status >= 500:
+					level = slog.LevelError
+				case status >= 400:
+					level = slog.LevelWarn
+				}
+				attrs := []any{
+					"method", r.Method,
+					"path", r.URL.Path,
+					"status", rw.Status(),
+					"bytes", rw.BytesWritten(),
+					"duration", time.Since(start),
+				}
+				// Set by http.ServeMux when routing, e.g. "POST /create-order"
+				if r.Pattern != "" {
+					attrs = append(attrs, logging.Route(r.Pattern))
+				}
+				if aborted {
+					attrs = append(attrs, "aborted", true)
+				}
+				slog.Log(r.Context(), level, "HTTP request", attrs...)
+			}()
+			next.ServeHTTP(rw, r)
+			aborted = false
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"local/shared/problem"
+)
+
+// MaxBodySize limits request bodies to n bytes: larger Content-Length values get a 413 response
+// and reading past n fails with *http.MaxBytesError.
+func MaxBodySize(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				problem.Write(w, r, problem.InvalidBody(&http.MaxBytesError{Limit: n}))
+				return
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = http.MaxBytesReader(w, r.Body, n)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
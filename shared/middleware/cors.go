@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"local/shared"
+	"local/shared/problem"
+)
+
+// CORSConfig is the cross-origin policy of CORS, bound from the CORS_* variables by CORSFromEnv.
+type CORSConfig struct {
+	// AllowedOrigins are origins like http://localhost:5173, "*" allows any. No origin is allowed when empty
+	AllowedOrigins []string `env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods []string `env:"CORS_ALLOWED_METHODS" default:"GET,HEAD,POST,PUT,PATCH,DELETE"`
+	// AllowedHeaders are the request headers besides the CORS-safelisted ones, "*" allows any
+	AllowedHeaders []string `env:"CORS_ALLOWED_HEADERS" default:"Content-Type,Authorization,X-Request-ID,traceparent,tracestate"`
+	// ExposedHeaders are the response headers scripts can read besides the CORS-safelisted ones
+	ExposedHeaders   []string      `env:"CORS_EXPOSED_HEADERS" default:"X-Request-ID,X-Fault"`
+	AllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `env:"CORS_MAX_AGE" default:"10m"`
+}
+
+// CORSOption adds what a server needs to a CORSConfig.
+type CORSOption func(*CORSConfig)
+
+// AllowHeaders allows request headers besides CORSConfig.AllowedHeaders, e.g. X-API-KEY.
+func AllowHeaders(headers ...string) CORSOption {
+	return func(c *CORSConfig) {
+		c.AllowedHeaders = append(c.AllowedHeaders, headers...)
+	}
+}
+
+// ExposeHeaders exposes response headers besides CORSConfig.ExposedHeaders, e.g. WWW-Authenticate.
+func ExposeHeaders(headers ...string) CORSOption {
+	return func(c *CORSConfig) {
+		c.ExposedHeaders = append(c.ExposedHeaders, headers...)
+	}
+}
+
+// Validate checks the origins, and that credentials aren't allowed to any origin.
+func (c *CORSConfig) Validate() error {
+	var errs []error
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			if c.AllowCredentials {
+				errs = append(errs, errors.New("CORS_ALLOWED_ORIGINS: credentials can't be allowed to any origin, list the origins"))
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS: %q isn't an origin like http://localhost:5173", origin))
+		}
+	}
+	if c.MaxAge < 0 {
+		errs = append(errs, errors.New("CORS_MAX_AGE: negative duration"))
+	}
+	return errors.Join(errs...)
+}
+
+// CORSFromEnv returns the CORS middleware of the CORS_* variables, see CORSConfig, with opts applied.
+// It goes outside Default, so injected faults and recovered panics carry the CORS headers too:
+//
+//	cors, err := middleware.CORSFromEnv(middleware.AllowHeaders("Stripe-Signature"))
+//	shared.RunServer(":8080", cors(middleware.Default(nil)))
+func CORSFromEnv(opts ...CORSOption) (Middleware, error) {
+	var config CORSConfig
+	if err := shared.Bind(&config); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if len(config.AllowedOrigins) > 0 {
+		slog.Info("🌐 CORS enabled", "origins", config.AllowedOrigins, "credentials", config.AllowCredentials)
+	}
+	return CORS(config), nil
+}
+
+// corsSafelistedHeaders are request headers allowed without being listed
+var corsSafelistedHeaders = []string{"accept", "accept-language", "content-language"}
+
+// CORS sets the CORS headers of requests from the allowed origins of config, and answers their
+// preflight requests. Preflights of other origins, methods or headers are a 403 problem naming what
+// isn't allowed. Requests without Origin, e.g. from apps and curl, are left alone.
+func CORS(config CORSConfig) Middleware {
+	anyOrigin := slices.Contains(config.AllowedOrigins, "*")
+	origins := make([]string, len(config.AllowedOrigins))
+	for i, origin := range config.AllowedOrigins {
+		origins[i] = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	}
+	anyHeader := slices.Contains(config.AllowedHeaders, "*")
+	allowedHeaders := make([]string, len(config.AllowedHeaders))
+	for i, header := range config.AllowedHeaders {
+		allowedHeaders[i] = strings.ToLower(header)
+	}
+	methods := strings.Join(config.AllowedMethods, ", ")
+	exposed := strings.Join(config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		if len(origins) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !anyOrigin {
+				// The response depends on the origin, even without CORS headers
+				w.Header().Add("Vary", "Origin")
+			}
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			allowed := anyOrigin || slices.Contains(origins, strings.ToLower(origin))
+
+			if !preflight {
+				if allowed {
+					setAllowOrigin(w, origin, anyOrigin, config.AllowCredentials)
+					if exposed != "" {
+						w.Header().Set("Access-Control-Expose-Headers", exposed)
+					}
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			method := r.Header.Get("Access-Control-Request-Method")
+			var requested []string
+			for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+				if header = strings.ToLower(strings.TrimSpace(header)); header != "" {
+					requested = append(requested, header)
+				}
+			}
+
+			var rejected string
+			switch {
+			case !allowed:
+				rejected = fmt.Sprintf("origin %s isn't allowed", origin)
+			case !slices.Contains(config.AllowedMethods, method):
+				rejected = fmt.Sprintf("method %s isn't allowed, use %s", method, methods)
+			case !anyHeader:
+				for _, header := range requested {
+					if !slices.Contains(allowedHeaders, header) && !slices.Contains(corsSafelistedHeaders, header) {
+						rejected = fmt.Sprintf("header %s isn't allowed", header)
+						break
+					}
+				}
+			}
+			if rejected != "" {
+				slog.WarnContext(r.Context(), "CORS preflight rejected", "origin", origin, "method", method,
+					"headers", requested, "reason", rejected)
+				problem.Write(w, r, problem.Forbidden("CORS preflight: "+rejected))
+				return
+			}
+
+			setAllowOrigin(w, origin, anyOrigin, config.AllowCredentials)
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			if len(requested) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+			}
+			if config.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// setAllowOrigin allows origin, with "*" when any origin is allowed without credentials.
+func setAllowOrigin(w http.ResponseWriter, origin string, anyOrigin, credentials bool) {
+	if anyOrigin && !credentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"local/shared/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("http_requests_total",
+		"HTTP requests by method, route and status code.", "method", "route", "code")
+	httpDuration = metrics.NewHistogram("http_request_duration_seconds",
+		"HTTP request latencies by method and route.", metrics.DefBuckets, "method", "route")
+	httpInFlight = metrics.NewGauge("http_requests_in_flight",
+		"HTTP requests being served.")
+)
+
+// Metrics counts the requests and their latency on metrics.Default, see metrics.Handler.
+// Requests are labeled with the http.ServeMux pattern rather than the path, to keep the
+// number of series bounded, and "unmatched" when none matched. Aborted responses, see
+// http.ErrAbortHandler, are counted with the code "aborted".
+func Metrics() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			httpInFlight.Inc()
+			defer httpInFlight.Dec()
+
+			rw := WrapResponseWriter(w)
+			aborted := true
+			defer func() {
+				route := r.Pattern
+				if route == "" {
+					route = "unmatched"
+				}
+				code := strconv.Itoa(rw.Status())
+				if aborted {
+					code = "aborted"
+				}
+				httpRequests.With(r.Method, route, code).Inc()
+				httpDuration.With(r.Method, route).Observe(time.Since(start).Seconds())
+			}()
+			next.ServeHTTP(rw, r)
+			aborted = false
+		})
+	}
+}
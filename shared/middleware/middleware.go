@@ -0,0 +1,36 @@
+// Package middleware wraps HTTP handlers with CORS, request IDs, tracing, access logs, metrics,
+// panic recovery, fault injection and body size limits.
+package middleware
+
+import (
+	"net/http"
+
+	"local/shared/faults"
+)
+
+// Middleware wraps a handler.
+type Middleware func(http.Handler) http.Handler
+
+// DefaultMaxBodySize is the request body limit of Default, 1 MiB.
+const DefaultMaxBodySize = 1 << 20
+
+// Chain wraps h with mws, the first one being the outermost:
+//
+//	handler := middleware.Chain(mux, middleware.RequestID(), middleware.AccessLog())
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Default wraps h, or http.DefaultServeMux when nil, with the usual chain:
+// RequestID, Trace, AccessLog, Metrics, Recover, the faults.Default rules and MaxBodySize(DefaultMaxBodySize).
+//
+//	shared.RunServer(":8080", middleware.Default(nil), shared.WithName("Stripe Server"))
+func Default(h http.Handler) http.Handler {
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	return Chain(h, RequestID(), Trace(), AccessLog(), Metrics(), Recover(), faults.Default.Middleware, MaxBodySize(DefaultMaxBodySize))
+}
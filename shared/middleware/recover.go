@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"local/shared/problem"
+)
+
+// Recover turns a panic of the handler into a 500 problem response, logging it with the stack trace.
+// http.ErrAbortHandler panics are left to the server, which aborts the response.
+func Recover() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := WrapResponseWriter(w)
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				slog.ErrorContext(r.Context(), "Handler panicked", "panic", p, "stack", string(debug.Stack()))
+				if !rw.Written() {
+					problem.Write(rw, r, problem.Internal())
+				}
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
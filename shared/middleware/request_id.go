@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"local/shared/logging"
+)
+
+// RequestIDHeader carries the request ID, from the client or generated, on requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID takes the X-Request-ID of the request, or generates one, and sets it on the response
+// and on the context: see RequestIDFrom, it's logged as request_id by slog.*Context too.
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+				r.Header.Set(RequestIDHeader, id)
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			ctx = logging.With(ctx, logging.RequestID(id))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFrom returns the request ID set by RequestID, to propagate it to other services:
+//
+//	req.Header.Set(middleware.RequestIDHeader, middleware.RequestIDFrom(r.Context()))
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts up to 128 printable ASCII characters, so client IDs can't forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter records the status and size of a response.
+type ResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WrapResponseWriter wraps w, unless it is a *ResponseWriter already.
+func WrapResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+func (w *ResponseWriter) WriteHeader(status int) {
+	// 1xx responses are informational, the final status comes later
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Status returns the response status, 200 when the handler wrote nothing.
+func (w *ResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// BytesWritten returns the size of the response body.
+func (w *ResponseWriter) BytesWritten() int64 { return w.bytes }
+
+// Written reports whether the headers were sent already.
+func (w *ResponseWriter) Written() bool { return w.status != 0 }
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Flush supports streaming responses.
+func (w *ResponseWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack supports websockets.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"local/shared/tracing"
+)
+
+// Trace starts a server span per request, child of the traceparent header when the client
+// sent one, named after the http.ServeMux pattern, e.g. "POST /create-order".
+// Handlers propagate it with tracing.Inject or tracing.Transport.
+func Trace() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if remote, ok := tracing.Extract(r.Header); ok {
+				ctx = tracing.ContextWithRemote(ctx, remote)
+			}
+			ctx, span := tracing.Start(ctx, r.Method+" "+r.URL.Path, tracing.KindServer)
+			defer span.End()
+			span.SetAttr("http.method", r.Method)
+			span.SetAttr("url.path", r.URL.Path)
+			if id := RequestIDFrom(ctx); id != "" {
+				span.SetAttr("request_id", id)
+			}
+
+			rw := WrapResponseWriter(w)
+			r = r.WithContext(ctx)
+			aborted := true
+			defer func() {
+				if r.Pattern != "" {
+					span.SetName(r.Pattern)
+					span.SetAttr("http.route", r.Pattern)
+				}
+				span.SetAttr("http.status_code", rw.Status())
+				switch {
+				case aborted:
+					span.SetErrorf("response aborted")
+				case rw.Status() >= 500:
+					span.SetErrorf("%s", http.StatusText(rw.Status()))
+				}
+			}()
+			next.ServeHTTP(rw, r)
+			aborted = false
+		})
+	}
+}
@@ -0,0 +1,354 @@
+// Package openapi serves the OpenAPI 3 document of a server on /openapi.json, and validates requests,
+// and optionally responses, against it:
+//
+//	//go:embed openapi.json
+//	var openapiSpec []byte
+//
+//	validate, err := openapi.Setup(nil, openapiSpec) // GET /openapi.json on http.DefaultServeMux
+//	shared.RunServer(":8080", middleware.Default(validate(http.DefaultServeMux)))
+//
+// Requests of paths missing from the document aren't validated, e.g. /metrics. The schemas support
+// a subset of JSON Schema, see Schema.
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Path is where Handle serves the document.
+const Path = "/openapi.json"
+
+// ResponsesEnvVar validates responses too when true, see Setup.
+const ResponsesEnvVar = "OPENAPI_VALIDATE_RESPONSES"
+
+// Document is an OpenAPI 3 document, with the members the validation uses.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	raw    []byte
+	routes []route
+}
+
+// Info describes the API.
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Components are the schemas and responses referenced with $ref, e.g. "#/components/schemas/Problem".
+type Components struct {
+	Schemas   map[string]*Schema   `json:"schemas"`
+	Responses map[string]*Response `json:"responses"`
+}
+
+// PathItem are the operations of a path, e.g. /users/{id}.
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters"`
+	Get        *Operation   `json:"get"`
+	Put        *Operation   `json:"put"`
+	Post       *Operation   `json:"post"`
+	Delete     *Operation   `json:"delete"`
+	Patch      *Operation   `json:"patch"`
+	Head       *Operation   `json:"head"`
+	Options    *Operation   `json:"options"`
+}
+
+// methods are the methods of the operations of a path item.
+var methods = []string{
+	http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodPatch, http.MethodHead, http.MethodOptions,
+}
+
+// operation returns the operation of method, nil when there's none.
+func (item *PathItem) operation(method string) *Operation {
+	switch method {
+	case http.MethodGet:
+		return item.Get
+	case http.MethodPut:
+		return item.Put
+	case http.MethodPost:
+		return item.Post
+	case http.MethodDelete:
+		return item.Delete
+	case http.MethodPatch:
+		return item.Patch
+	case http.MethodHead:
+		return item.Head
+	case http.MethodOptions:
+		return item.Options
+	}
+	return nil
+}
+
+// Operation is a method of a path.
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+
+	// parameters has the ones of the path item too
+	parameters []*Parameter
+}
+
+// Parameter is a path, query or header parameter. Cookie parameters aren't validated.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody are the accepted media types of a request.
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is the response of a status: "200", "4XX" or "default".
+type Response struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// MediaType is the schema of a body, only JSON bodies are validated.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// route is a path template split in segments, e.g. ["users", "{id}"].
+type route struct {
+	template string
+	segments []string
+	item     *PathItem
+}
+
+// match returns the path parameters when path matches the route.
+func (rt *route) match(path string) (map[string]string, bool) {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, segment := range rt.segments {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[strings.TrimSuffix(name, "}")] = segments[i]
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// literals counts the segments without parameters, /users/me wins over /users/{id}.
+func (rt *route) literals() int {
+	n := 0
+	for _, segment := range rt.segments {
+		if !strings.HasPrefix(segment, "{") {
+			n++
+		}
+	}
+	return n
+}
+
+// Parse parses and checks a JSON OpenAPI 3 document, resolving its $ref.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("openapi: version %q, want 3.x", doc.OpenAPI)
+	}
+	doc.raw = data
+
+	var errs []error
+	r := resolver{doc: &doc, done: map[*Schema]bool{}}
+	for _, name := range slices.Sorted(maps.Keys(doc.Components.Schemas)) {
+		schema := doc.Components.Schemas[name]
+		r.schema(&schema, "#/components/schemas/"+name, &errs)
+		doc.Components.Schemas[name] = schema
+	}
+	for _, template := range slices.Sorted(maps.Keys(doc.Paths)) {
+		item := doc.Paths[template]
+		if item == nil || !strings.HasPrefix(template, "/") {
+			errs = append(errs, fmt.Errorf("path %q: must start with / and have operations", template))
+			continue
+		}
+		rt := route{template: template, segments: strings.Split(strings.TrimPrefix(template, "/"), "/"), item: item}
+		for _, method := range methods {
+			op := item.operation(method)
+			if op == nil {
+				continue
+			}
+			at := method + " " + template
+			op.parameters = slices.Clone(item.Parameters)
+			for _, p := range op.Parameters {
+				// Operation parameters override the ones of the path item
+				op.parameters = slices.DeleteFunc(op.parameters, func(q *Parameter) bool { return q.Name == p.Name && q.In == p.In })
+				op.parameters = append(op.parameters, p)
+			}
+			for _, p := range op.parameters {
+				r.parameter(p, &rt, at, &errs)
+			}
+			if op.RequestBody != nil {
+				for mediaType, content := range op.RequestBody.Content {
+					r.schema(&content.Schema, at+" request "+mediaType, &errs)
+				}
+			}
+			for status, resp := range op.Responses {
+				r.response(&resp, at+" response "+status, &errs)
+				op.Responses[status] = resp
+			}
+		}
+		doc.routes = append(doc.routes, rt)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	// Deterministic matching, with literal segments first
+	slices.SortFunc(doc.routes, func(a, b route) int {
+		if n := b.literals() - a.literals(); n != 0 {
+			return n
+		}
+		return strings.Compare(a.template, b.template)
+	})
+	return &doc, nil
+}
+
+// resolver replaces $ref with the component they reference, and compiles patterns.
+type resolver struct {
+	doc  *Document
+	done map[*Schema]bool
+}
+
+func (r *resolver) schema(s **Schema, at string, errs *[]error) {
+	if *s == nil {
+		return
+	}
+	for hops := 0; (*s).Ref != ""; hops++ {
+		ref := (*s).Ref
+		name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+		target := r.doc.Components.Schemas[name]
+		if !ok || target == nil || hops > len(r.doc.Components.Schemas) {
+			*errs = append(*errs, fmt.Errorf("%s: unknown or circular $ref %q", at, ref))
+			*s = nil
+			return
+		}
+		*s = target
+	}
+	schema := *s
+	if r.done[schema] {
+		return
+	}
+	r.done[schema] = true
+	if schema.Pattern != "" {
+		pattern, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: %w", at, err))
+		}
+		schema.pattern = pattern
+	}
+	for name := range schema.Properties {
+		property := schema.Properties[name]
+		r.schema(&property, at+"."+name, errs)
+		schema.Properties[name] = property
+	}
+	r.schema(&schema.Items, at+"[]", errs)
+	r.schema(&schema.AdditionalProperties, at+".*", errs)
+}
+
+func (r *resolver) parameter(p *Parameter, rt *route, at string, errs *[]error) {
+	switch p.In {
+	case "path":
+		if !slices.Contains(rt.segments, "{"+p.Name+"}") {
+			*errs = append(*errs, fmt.Errorf("%s: path parameter %q isn't in the path", at, p.Name))
+		}
+	case "query", "header", "cookie":
+	default:
+		*errs = append(*errs, fmt.Errorf("%s: parameter %q in %q, want path, query, header or cookie", at, p.Name, p.In))
+	}
+	r.schema(&p.Schema, at+" parameter "+p.Name, errs)
+}
+
+func (r *resolver) response(resp **Response, at string, errs *[]error) {
+	if *resp == nil {
+		*errs = append(*errs, fmt.Errorf("%s: empty response", at))
+		return
+	}
+	if ref := (*resp).Ref; ref != "" {
+		name, ok := strings.CutPrefix(ref, "#/components/responses/")
+		target := r.doc.Components.Responses[name]
+		if !ok || target == nil {
+			*errs = append(*errs, fmt.Errorf("%s: unknown $ref %q", at, ref))
+			return
+		}
+		*resp = target
+	}
+	for mediaType, content := range (*resp).Content {
+		r.schema(&content.Schema, at+" "+mediaType, errs)
+	}
+}
+
+// find returns the path item of path, with its parameters.
+func (d *Document) find(path string) (*route, map[string]string) {
+	for i := range d.routes {
+		if params, ok := d.routes[i].match(path); ok {
+			return &d.routes[i], params
+		}
+	}
+	return nil, nil
+}
+
+// Handler serves the document as it was parsed.
+func (d *Document) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(d.raw)
+	})
+}
+
+// Handle serves the document on GET /openapi.json of mux, or http.DefaultServeMux when nil.
+func (d *Document) Handle(mux *http.ServeMux) {
+	if mux == nil {
+		mux = http.DefaultServeMux
+	}
+	mux.Handle("GET "+Path, d.Handler())
+}
+
+// Setup parses spec and serves it on mux, or http.DefaultServeMux when nil. It returns the middleware
+// validating requests, and responses too when OPENAPI_VALIDATE_RESPONSES is true.
+func Setup(mux *http.ServeMux, spec []byte) (func(http.Handler) http.Handler, error) {
+	doc, err := Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if env := os.Getenv(ResponsesEnvVar); env != "" {
+		validateResponses, err := strconv.ParseBool(env)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ResponsesEnvVar, err)
+		}
+		if validateResponses {
+			opts = append(opts, WithResponseValidation())
+		}
+	}
+	doc.Handle(mux)
+	return func(next http.Handler) http.Handler { return doc.Validator(next, opts...) }, nil
+}
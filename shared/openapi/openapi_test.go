@@ -0,0 +1,345 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSpec = `{
+  "openapi": "3.0.3",
+  "info": {"title": "Test", "version": "1"},
+  "paths": {
+    "/users/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "minimum": 1}}],
+      "get": {
+        "operationId": "getUser",
+        "parameters": [
+          {"name": "expand", "in": "query", "schema": {"type": "string", "enum": ["orders", "profile"]}},
+          {"name": "X-Version", "in": "header", "required": true, "schema": {"type": "string"}}
+        ],
+        "responses": {"200": {"$ref": "#/components/responses/User"}}
+      }
+    },
+    "/users/me": {
+      "get": {"operationId": "getMe", "responses": {"200": {"$ref": "#/components/responses/User"}}}
+    },
+    "/a/{x}/c": {"get": {"operationId": "axc", "responses": {"200": {"description": "ok"}}}},
+    "/a/b/{y}": {"get": {"operationId": "aby", "responses": {"200": {"description": "ok"}}}},
+    "/{p}/q/r": {"get": {"operationId": "pqr", "responses": {"200": {"description": "ok"}}}},
+    "/p/{q}/{r}": {"get": {"operationId": "pqr2", "responses": {"200": {"description": "ok"}}}},
+    "/payments": {
+      "post": {
+        "operationId": "createPayment",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Payment"}}}
+        },
+        "responses": {"201": {"description": "created"}, "4XX": {"description": "error"}}
+      },
+      "put": {"operationId": "putPayment", "responses": {"200": {"description": "ok"}}}
+    }
+  },
+  "components": {
+    "schemas": {
+      "Payment": {
+        "type": "object",
+        "required": ["amount", "currency"],
+        "additionalProperties": false,
+        "properties": {
+          "amount": {"type": "integer", "minimum": 1},
+          "currency": {"$ref": "#/components/schemas/Currency"}
+        }
+      },
+      "Currency": {"type": "string", "pattern": "^[A-Z]{3}$"},
+      "User": {
+        "type": "object",
+        "required": ["id"],
+        "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}
+      }
+    },
+    "responses": {
+      "User": {"description": "A user", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}}
+    }
+  }
+}`
+
+func parseTestSpec(t *testing.T) *Document {
+	t.Helper()
+	doc, err := Parse([]byte(testSpec))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return doc
+}
+
+func TestFind(t *testing.T) {
+	doc := parseTestSpec(t)
+	tests := []struct {
+		path     string
+		template string
+		params   map[string]string
+	}{
+		// Literal segments win, whatever the order of the document
+		{"/users/me", "/users/me", map[string]string{}},
+		{"/users/42", "/users/{id}", map[string]string{"id": "42"}},
+		// Same number of literals: by template
+		{"/a/b/c", "/a/b/{y}", map[string]string{"y": "c"}},
+		{"/a/x/c", "/a/{x}/c", map[string]string{"x": "x"}},
+		// More literals win, even when later by template
+		{"/p/q/r", "/{p}/q/r", map[string]string{"p": "p"}},
+		{"/p/x/r", "/p/{q}/{r}", map[string]string{"q": "x", "r": "r"}},
+		{"/users/", "", nil},
+		{"/users/42/orders", "", nil},
+		{"/payments/", "", nil},
+		{"/metrics", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rt, params := doc.find(tt.path)
+			var template string
+			if rt != nil {
+				template = rt.template
+			}
+			if template != tt.template || !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("find() = %q %v, want %q %v", template, params, tt.template, tt.params)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"version", `{"openapi": "2.0"}`, `version "2.0", want 3.x`},
+		{"unknown schema", `{"openapi": "3.0.0", "paths": {"/a": {"get": {"requestBody": {"content":
+			{"application/json": {"schema": {"$ref": "#/components/schemas/Nope"}}}}}}}}`, `unknown or circular $ref`},
+		{"circular schemas", `{"openapi": "3.0.0", "components": {"schemas": {
+			"A": {"$ref": "#/components/schemas/B"}, "B": {"$ref": "#/components/schemas/A"}}}}`, `unknown or circular $ref`},
+		{"unknown response", `{"openapi": "3.0.0", "paths": {"/a": {"get": {"responses":
+			{"200": {"$ref": "#/components/responses/Nope"}}}}}}`, `unknown $ref`},
+		{"path parameter not in the path", `{"openapi": "3.0.0", "paths": {"/a": {"get": {"parameters":
+			[{"name": "id", "in": "path"}]}}}}`, `path parameter "id" isn't in the path`},
+		{"parameter location", `{"openapi": "3.0.0", "paths": {"/a": {"get": {"parameters":
+			[{"name": "id", "in": "body"}]}}}}`, `want path, query, header or cookie`},
+		{"invalid pattern", `{"openapi": "3.0.0", "components": {"schemas": {"A": {"pattern": "["}}}}`, `missing closing ]`},
+		{"relative path", `{"openapi": "3.0.0", "paths": {"a": {"get": {}}}}`, `must start with /`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.spec)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// testProblem is what the tests check of a problem response.
+type testProblem struct {
+	Status int      `json:"status"`
+	Detail string   `json:"detail"`
+	Errors []string `json:"errors"`
+}
+
+func TestValidator(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	validator := parseTestSpec(t).Validator(next)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		header      http.Header
+		body        string
+		status      int
+		detail      string
+		errors      []string
+		allowHeader string
+	}{
+		{name: "not in the document", method: "GET", path: "/metrics", status: http.StatusTeapot},
+		{name: "valid get", method: "GET", path: "/users/42?expand=orders", header: http.Header{"X-Version": {"1"}}, status: http.StatusTeapot},
+		{name: "head is validated as get", method: "HEAD", path: "/users/abc", header: http.Header{"X-Version": {"1"}},
+			status: http.StatusBadRequest, detail: `path.id: must be an integer, got "abc"`},
+		{name: "options preflight", method: "OPTIONS", path: "/users/42", status: http.StatusTeapot},
+		{name: "method not allowed", method: "DELETE", path: "/payments",
+			status: http.StatusMethodNotAllowed, detail: "DELETE isn't an operation of /payments, use PUT or POST", allowHeader: "PUT, POST"},
+		{name: "parameters", method: "GET", path: "/users/0?expand=all", status: http.StatusBadRequest,
+			detail: "path.id: must be at least 1, and 2 more errors",
+			errors: []string{"path.id: must be at least 1", `query.expand: must be one of "orders", "profile"`, "header.X-Version: is required"}},
+		{name: "valid body", method: "POST", path: "/payments", header: http.Header{"Content-Type": {"application/json; charset=utf-8"}},
+			body: `{"amount": 10, "currency": "EUR"}`, status: http.StatusTeapot},
+		{name: "missing body", method: "POST", path: "/payments", status: http.StatusBadRequest, detail: "body: is required"},
+		{name: "missing content type", method: "POST", path: "/payments", body: `{}`,
+			status: http.StatusUnsupportedMediaType, detail: "missing Content-Type, use application/json"},
+		{name: "other content type", method: "POST", path: "/payments", header: http.Header{"Content-Type": {"text/plain"}}, body: `{}`,
+			status: http.StatusUnsupportedMediaType, detail: `Content-Type "text/plain" isn't accepted, use application/json`},
+		{name: "invalid JSON", method: "POST", path: "/payments", header: http.Header{"Content-Type": {"application/json"}}, body: `{"amount":`,
+			status: http.StatusBadRequest, detail: "body: invalid JSON: unexpected EOF"},
+		{name: "invalid body", method: "POST", path: "/payments", header: http.Header{"Content-Type": {"application/json"}},
+			body: `{"amount": "10", "currency": "eur", "note": "x"}`, status: http.StatusBadRequest,
+			detail: `body.amount: must be an integer, got "10", and 2 more errors`,
+			errors: []string{`body.amount: must be an integer, got "10"`, "body.currency: must match ^[A-Z]{3}$", "body.note: is not allowed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+			validator.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := w.Header().Get("Allow"); got != tt.allowHeader {
+				t.Errorf("Allow = %q, want %q", got, tt.allowHeader)
+			}
+			if tt.detail == "" || tt.method == "HEAD" {
+				return
+			}
+			var p testProblem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("problem %s: %v", w.Body, err)
+			}
+			if p.Detail != tt.detail {
+				t.Errorf("detail = %q, want %q", p.Detail, tt.detail)
+			}
+			if tt.errors != nil && !reflect.DeepEqual(p.Errors, tt.errors) {
+				t.Errorf("errors = %q, want %q", p.Errors, tt.errors)
+			}
+		})
+	}
+}
+
+func TestValidatorKeepsTheBody(t *testing.T) {
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+		got = buf.String()
+	})
+	body := `{"amount": 10, "currency": "EUR"}`
+	r := httptest.NewRequest("POST", "/payments", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	parseTestSpec(t).Validator(next).ServeHTTP(httptest.NewRecorder(), r)
+	if got != body {
+		t.Errorf("body of the handler = %q, want %q", got, body)
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	op := parseTestSpec(t).Paths["/users/{id}"].Get
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        []string
+	}{
+		{"valid", 200, "application/json", `{"id": 42}`, nil},
+		{"invalid", 200, "application/json", `{"name": 42}`, []string{"response.id: is required", "response.name: must be a string, got 42"}},
+		{"sniffed content type", 200, "", `{"id": 42}`, []string{`Content-Type "text/plain" isn't a response 200 media type`}},
+		{"undocumented status", 500, "application/json", `{}`, []string{"status 500 isn't a response of the operation"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{ResponseWriter: httptest.NewRecorder()}
+			if tt.contentType != "" {
+				rec.Header().Set("Content-Type", tt.contentType)
+			}
+			rec.WriteHeader(tt.status)
+			rec.Write([]byte(tt.body))
+			if got := validateResponse(rec, op); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateResponse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 4XX matches the 4xx statuses
+	rec := &recorder{ResponseWriter: httptest.NewRecorder()}
+	rec.WriteHeader(http.StatusConflict)
+	if got := validateResponse(rec, parseTestSpec(t).Paths["/payments"].Post); got != nil {
+		t.Errorf("validateResponse() of a 409 = %q, want no errors", got)
+	}
+}
+
+func TestSchemaKeywords(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   []string
+	}{
+		{"type", `{"type": "string"}`, `1`, []string{"v: must be a string, got 1"}},
+		{"integer", `{"type": "integer"}`, `1.5`, []string{"v: must be an integer, got 1.5"}},
+		{"integer with a zero fraction", `{"type": "integer"}`, `2.0`, nil},
+		{"number", `{"type": "number"}`, `1.5`, nil},
+		{"boolean", `{"type": "boolean"}`, `"true"`, []string{`v: must be a boolean, got "true"`}},
+		{"null", `{"type": "string"}`, `null`, []string{"v: must be a string, got null"}},
+		{"nullable", `{"type": "string", "nullable": true}`, `null`, nil},
+		{"enum", `{"enum": ["a", 1, true]}`, `"b"`, []string{`v: must be one of "a", 1, true`}},
+		{"enum number", `{"enum": ["a", 1, true]}`, `1.0`, nil},
+		{"enum of objects never matches", `{"enum": [{"a": 1}]}`, `{"a": 1}`, []string{`v: must be one of {"a":1}`}},
+		{"required", `{"type": "object", "required": ["a", "b"]}`, `{"a": 1}`, []string{"v.b: is required"}},
+		{"properties", `{"properties": {"a": {"type": "string"}}}`, `{"a": 1, "b": 2}`, []string{"v.a: must be a string, got 1"}},
+		{"additionalProperties false", `{"properties": {"a": {}}, "additionalProperties": false}`, `{"a": 1, "b": 2}`, []string{"v.b: is not allowed"}},
+		{"additionalProperties schema", `{"additionalProperties": {"type": "integer"}}`, `{"a": 1, "b": "2"}`, []string{`v.b: must be an integer, got "2"`}},
+		{"items", `{"items": {"type": "integer"}}`, `[1, "2"]`, []string{`v[1]: must be an integer, got "2"`}},
+		{"minItems", `{"minItems": 2}`, `[1]`, []string{"v: must have at least 2 items"}},
+		{"maxItems", `{"maxItems": 1}`, `[1, 2]`, []string{"v: must have at most 1 items"}},
+		{"minimum", `{"minimum": 1.5}`, `1`, []string{"v: must be at least 1.5"}},
+		{"maximum", `{"maximum": 10}`, `11`, []string{"v: must be at most 10"}},
+		{"minLength counts runes", `{"minLength": 3}`, `"éé"`, []string{"v: must have at least 3 characters"}},
+		{"maxLength", `{"maxLength": 2}`, `"abc"`, []string{"v: must have at most 2 characters"}},
+		{"pattern", `{"pattern": "^a+$"}`, `"ab"`, []string{"v: must match ^a+$"}},
+		{"date-time", `{"format": "date-time"}`, `"2024-05-01"`, []string{"v: must be an RFC 3339 date-time, e.g. 2024-05-01T10:00:00Z"}},
+		{"valid date-time", `{"format": "date-time"}`, `"2024-05-01T10:00:00+02:00"`, nil},
+		{"uri", `{"format": "uri"}`, `"/relative"`, []string{"v: must be an absolute URI"}},
+		{"keywords of other types are ignored", `{"minLength": 5, "minimum": 5}`, `[1]`, nil},
+		{"true schema", `true`, `{"any": [1]}`, nil},
+		{"false schema", `false`, `1`, []string{"v: is not allowed"}},
+		{"nested", `{"properties": {"items": {"items": {"required": ["id"]}}}}`, `{"items": [{"id": 1}, {}]}`, []string{"v.items[1].id: is required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(`{"openapi": "3.0.0", "components": {"schemas": {"S": ` + tt.schema + `}}}`))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var errs []string
+			validateJSON(&MediaType{Schema: doc.Components.Schemas["S"]}, "application/json", []byte(tt.value), "v", &errs)
+			if !reflect.DeepEqual(errs, tt.want) {
+				t.Errorf("validate() = %q, want %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestParameterParse(t *testing.T) {
+	tests := []struct {
+		typ   string
+		value string
+		ok    bool
+	}{
+		{"integer", "42", true},
+		{"integer", "4x", false},
+		{"number", "1.5", true},
+		{"boolean", "true", true},
+		{"boolean", "yes", false},
+		{"string", "anything", true},
+	}
+	for _, tt := range tests {
+		if _, ok := (&Schema{Type: tt.typ}).parse(tt.value); ok != tt.ok {
+			t.Errorf("parse(%q) as %s ok = %v, want %v", tt.value, tt.typ, ok, tt.ok)
+		}
+	}
+}
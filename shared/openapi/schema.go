@@ -0,0 +1,229 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema the validation supports: type, nullable, enum, properties,
+// required, additionalProperties, items, minimum, maximum, minLength, maxLength, pattern, minItems,
+// maxItems and the date-time and uri formats. Other keywords are ignored.
+type Schema struct {
+	Ref         string `json:"$ref,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Description string `json:"description,omitempty"`
+	Nullable    bool   `json:"nullable,omitempty"`
+	Enum        []any  `json:"enum,omitempty"`
+
+	// Objects
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	// Arrays
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	// Numbers
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+
+	// Strings
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+	// never is the false schema, e.g. "additionalProperties": false
+	never bool
+}
+
+// UnmarshalJSON accepts the true and false schemas besides objects.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true":
+		*s = Schema{}
+		return nil
+	case "false":
+		*s = Schema{never: true}
+		return nil
+	}
+	type plain Schema
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// validate appends the errors of value, decoded with json.Decoder.UseNumber, to errs.
+// at is where value is, e.g. "body.items[0].price".
+func (s *Schema) validate(value any, at string, errs *[]string) {
+	if s == nil {
+		return
+	}
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, at+": "+fmt.Sprintf(format, args...))
+	}
+	if s.never {
+		fail("is not allowed")
+		return
+	}
+	if value == nil {
+		if !s.Nullable && s.Type != "" {
+			fail("must be %s, got null", article(s.Type))
+		}
+		return
+	}
+	if s.Type != "" && !hasType(value, s.Type) {
+		fail("must be %s, got %s", article(s.Type), typeOf(value))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return equal(e, value) }) {
+		fail("must be one of %s", enumString(s.Enum))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, at+"."+name+": is required")
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(v)) {
+			if property, ok := s.Properties[name]; ok {
+				property.validate(v[name], at+"."+name, errs)
+			} else {
+				s.AdditionalProperties.validate(v[name], at+"."+name, errs)
+			}
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		for i, item := range v {
+			s.Items.validate(item, fmt.Sprintf("%s[%d]", at, i), errs)
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("must have at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must have at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match %s", s.Pattern)
+		}
+		switch s.Format {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				fail("must be an RFC 3339 date-time, e.g. 2024-05-01T10:00:00Z")
+			}
+		case "uri":
+			if u, err := url.Parse(v); err != nil || u.Scheme == "" {
+				fail("must be an absolute URI")
+			}
+		}
+	}
+}
+
+// parse converts the string of a path, query or header parameter to the type of s.
+func (s *Schema) parse(value string) (any, bool) {
+	if s == nil {
+		return value, true
+	}
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(value), true
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		return b, err == nil
+	}
+	return value, true
+}
+
+func hasType(value any, typ string) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		return typ == "object"
+	case []any:
+		return typ == "array"
+	case string:
+		return typ == "string"
+	case bool:
+		return typ == "boolean"
+	case json.Number:
+		if typ == "integer" {
+			n, err := v.Float64()
+			return err == nil && n == math.Trunc(n)
+		}
+		return typ == "number"
+	}
+	return false
+}
+
+func typeOf(value any) string {
+	switch v := value.(type) {
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return strconv.Quote(v)
+	case json.Number:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func article(typ string) string {
+	switch typ {
+	case "object", "array", "integer":
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+// equal compares an enum value with a decoded one, numbers by value. Enums of objects or arrays never match.
+func equal(enum, value any) bool {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		e, ok := enum.(float64)
+		return ok && e == f
+	case string, bool:
+		return enum == v
+	}
+	return false
+}
+
+func enumString(enum []any) string {
+	values := make([]string, len(enum))
+	for i, e := range enum {
+		b, _ := json.Marshal(e)
+		values[i] = string(b)
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,262 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	// Local
+	"local/shared/metrics"
+	"local/shared/problem"
+)
+
+// maxResponseSize is the largest response body validated, bigger ones are only checked for their status.
+const maxResponseSize = 1 << 20
+
+var violationsTotal = metrics.NewCounter("openapi_violations_total",
+	"Requests and responses not matching the OpenAPI document, by kind and operation.", "kind", "operation")
+
+// Option configures a Validator.
+type Option func(*options)
+
+type options struct {
+	responses bool
+}
+
+// WithResponseValidation validates responses too, logging the ones not matching the document.
+// They're sent unchanged: it finds the handlers drifting from the document, e.g. on tests.
+func WithResponseValidation() Option {
+	return func(o *options) {
+		o.responses = true
+	}
+}
+
+// Validator validates the requests of next, answering a 400 problem listing every error of the
+// ones not matching the document, e.g.
+//
+//	{"type":"/problems/invalid-request","status":400,"detail":"body.amount: must be an integer, got \"10\"",
+//	 "errors":["body.amount: must be an integer, got \"10\""], ...}
+//
+// Methods missing from a path are a 405, and body media types missing from an operation a 415.
+func (d *Document) Validator(next http.Handler, opts ...Option) http.Handler {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt, pathParams := d.find(r.URL.Path)
+		if rt == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		op := rt.item.operation(r.Method)
+		if op == nil && r.Method == http.MethodHead {
+			op = rt.item.Get
+		}
+		if op == nil {
+			if r.Method == http.MethodOptions {
+				// CORS preflights
+				next.ServeHTTP(w, r)
+				return
+			}
+			var allowed []string
+			for _, method := range methods {
+				if rt.item.operation(method) != nil {
+					allowed = append(allowed, method)
+				}
+			}
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			problem.Write(w, r, problem.New(http.StatusMethodNotAllowed, problem.TypeInvalidRequest,
+				fmt.Sprintf("%s isn't an operation of %s, use %s", r.Method, rt.template, strings.Join(allowed, " or "))))
+			return
+		}
+		name := op.OperationID
+		if name == "" {
+			name = r.Method + " " + rt.template
+		}
+
+		errs, p := validateRequest(r, op, pathParams)
+		if p == nil && len(errs) > 0 {
+			detail := errs[0]
+			if len(errs) > 1 {
+				detail = fmt.Sprintf("%s, and %d more errors", errs[0], len(errs)-1)
+			}
+			p = problem.BadRequest("%s", detail).With("errors", errs)
+		}
+		if p != nil {
+			violationsTotal.With("request", name).Inc()
+			slog.WarnContext(r.Context(), "Request doesn't match the OpenAPI document", "operation", name, "status", p.Status, "detail", p.Detail)
+			problem.Write(w, r, p)
+			return
+		}
+
+		if !o.responses {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &recorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if errs := validateResponse(rec, op); len(errs) > 0 {
+			violationsTotal.With("response", name).Inc()
+			slog.ErrorContext(r.Context(), "Response doesn't match the OpenAPI document", "operation", name, "status", rec.Status(), "errors", errs)
+		}
+	})
+}
+
+// validateRequest returns the errors of the parameters and body of r, or the problem of a request
+// that can't be validated.
+func validateRequest(r *http.Request, op *Operation, pathParams map[string]string) ([]string, *problem.Problem) {
+	var errs []string
+	query := r.URL.Query()
+	for _, param := range op.parameters {
+		var values []string
+		switch param.In {
+		case "path":
+			values = []string{pathParams[param.Name]}
+		case "query":
+			values = query[param.Name]
+		case "header":
+			values = r.Header.Values(param.Name)
+		default:
+			continue
+		}
+		at := param.In + "." + param.Name
+		if len(values) == 0 || values[0] == "" {
+			if param.Required {
+				errs = append(errs, at+": is required")
+			}
+			continue
+		}
+		value, ok := param.Schema.parse(values[0])
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: must be %s, got %q", at, article(param.Schema.Type), values[0]))
+			continue
+		}
+		param.Schema.validate(value, at, &errs)
+	}
+
+	if op.RequestBody == nil {
+		return errs, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return errs, problem.InvalidBody(err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) == 0 {
+		if op.RequestBody.Required {
+			errs = append(errs, "body: is required")
+		}
+		return errs, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	content, ok := op.RequestBody.Content[mediaType]
+	if !ok {
+		accepted := strings.Join(slices.Sorted(maps.Keys(op.RequestBody.Content)), " or ")
+		detail := fmt.Sprintf("Content-Type %q isn't accepted, use %s", mediaType, accepted)
+		if mediaType == "" {
+			detail = "missing Content-Type, use " + accepted
+		}
+		return errs, problem.New(http.StatusUnsupportedMediaType, problem.TypeInvalidRequest, detail)
+	}
+	validateJSON(content, mediaType, body, "body", &errs)
+	return errs, nil
+}
+
+// validateJSON validates a JSON body against the schema of content, other media types aren't validated.
+func validateJSON(content *MediaType, mediaType string, body []byte, at string, errs *[]string) {
+	if content == nil || content.Schema == nil || !isJSON(mediaType) {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		*errs = append(*errs, at+": invalid JSON: "+err.Error())
+		return
+	}
+	content.Schema.validate(value, at, errs)
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// validateResponse returns the errors of a recorded response.
+func validateResponse(rec *recorder, op *Operation) []string {
+	status := rec.Status()
+	code := strconv.Itoa(status)
+	resp, ok := op.Responses[code]
+	if !ok {
+		resp, ok = op.Responses[code[:1]+"XX"]
+	}
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return []string{fmt.Sprintf("status %d isn't a response of the operation", status)}
+	}
+	if len(resp.Content) == 0 || rec.body.Len() == 0 || rec.truncated {
+		return nil
+	}
+	contentType := rec.Header().Get("Content-Type")
+	if contentType == "" {
+		// Set by the server after the handler
+		contentType = http.DetectContentType(rec.body.Bytes())
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	content, ok := resp.Content[mediaType]
+	if !ok {
+		return []string{fmt.Sprintf("Content-Type %q isn't a response %d media type", mediaType, status)}
+	}
+	var errs []string
+	validateJSON(content, mediaType, rec.body.Bytes(), "response", &errs)
+	return errs
+}
+
+// recorder keeps a copy of the response it writes, up to maxResponseSize.
+type recorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *recorder) WriteHeader(status int) {
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.body.Len()+len(b) > maxResponseSize {
+		w.truncated = true
+	} else {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Status returns the response status, 200 when the handler wrote nothing.
+func (w *recorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *recorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
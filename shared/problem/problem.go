@@ -0,0 +1,154 @@
+// Package problem writes RFC 7807 application/problem+json error responses:
+//
+//	{"type":"/problems/invalid-request","title":"Bad Request","status":400,
+//	 "detail":"missing orderId","instance":"/capture-order","request_id":"6c70..."}
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// requestIDHeader is set on responses by middleware.RequestID.
+const requestIDHeader = "X-Request-ID"
+
+// Problem types, relative to the server, so clients can switch on them instead of the detail text.
+const (
+	TypeBlank          = "about:blank" // no more semantics than the status code
+	TypeInvalidRequest = "/problems/invalid-request"
+	TypeUnauthorized   = "/problems/unauthorized"
+	TypeForbidden      = "/problems/forbidden"
+	TypePaymentFailed  = "/problems/payment-failed"
+	TypeUpstream       = "/problems/upstream-error"
+	TypeInternal       = "/problems/internal-error"
+)
+
+// Problem is an RFC 7807 error response.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	// Detail is shown to users, so it must not leak internals, log those instead
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Extensions are extra members, e.g. "paypal_debug_id"
+	Extensions map[string]any `json:"-"`
+}
+
+// New creates a problem of type typ, titled after the status.
+func New(status int, typ, detail string) *Problem {
+	return &Problem{Type: typ, Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// BadRequest is a 400 invalid request problem.
+func BadRequest(format string, args ...any) *Problem {
+	return New(http.StatusBadRequest, TypeInvalidRequest, fmt.Sprintf(format, args...))
+}
+
+// Unauthorized is a 401 problem.
+func Unauthorized(detail string) *Problem {
+	return New(http.StatusUnauthorized, TypeUnauthorized, detail)
+}
+
+// Forbidden is a 403 problem, for authenticated clients lacking a permission.
+func Forbidden(detail string) *Problem {
+	return New(http.StatusForbidden, TypeForbidden, detail)
+}
+
+// BadGateway is a 502 problem for failed calls to other services.
+func BadGateway(detail string) *Problem {
+	return New(http.StatusBadGateway, TypeUpstream, detail)
+}
+
+// Internal is a 500 problem.
+func Internal() *Problem {
+	return New(http.StatusInternalServerError, TypeInternal, "")
+}
+
+// With sets the extension member key, and returns p.
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = map[string]any{}
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return fmt.Sprintf("%d %s", p.Status, p.Title)
+	}
+	return fmt.Sprintf("%d %s: %s", p.Status, p.Title, p.Detail)
+}
+
+// MarshalJSON adds the extensions next to the standard members.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	body, err := json.Marshal((*plain)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+	members := map[string]any{}
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	var standard map[string]any
+	if err := json.Unmarshal(body, &standard); err != nil {
+		return nil, err
+	}
+	// Standard members win over extensions with the same name
+	for key, value := range standard {
+		members[key] = value
+	}
+	return json.Marshal(members)
+}
+
+// Write sends p, filling the instance with the request path and the request ID from the
+// X-Request-ID response header (see middleware.RequestID).
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Type == "" {
+		p.Type = TypeBlank
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = w.Header().Get(requestIDHeader)
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		p.Extensions = nil
+		body, _ = json.Marshal(p)
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(p.Status)
+	w.Write(append(body, '\n'))
+}
+
+// Error is a drop-in replacement of http.Error writing an about:blank problem.
+func Error(w http.ResponseWriter, r *http.Request, detail string, status int) {
+	Write(w, r, New(status, TypeBlank, detail))
+}
+
+// InvalidBody is the problem of a request body failing to decode: 413 when it's over the
+// limit of http.MaxBytesReader, 400 otherwise.
+func InvalidBody(err error) *Problem {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return New(http.StatusRequestEntityTooLarge, TypeInvalidRequest,
+			fmt.Sprintf("request body larger than %d bytes", tooLarge.Limit))
+	}
+	return BadRequest("invalid request body: %v", err)
+}
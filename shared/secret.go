@@ -0,0 +1,97 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// SecretPatterns are the env keys considered secrets by IsSecretKey, see path.Match for the syntax.
+var SecretPatterns = []string{"*_SECRET", "*_KEY", "*_TOKEN", "*_PASSWORD"}
+
+// Secret holds a sensitive value (API keys, client secrets, tokens...) that redacts
+// itself on fmt, log, log/slog and JSON output. Use Reveal to get the actual value.
+//
+// Secret fields are filled by Bind:
+//
+//	type Config struct {
+//		SecretKey shared.Secret `env:"STRIPE_SECRET_KEY,required"`
+//	}
+type Secret struct {
+	value string
+}
+
+// NewSecret wraps value into a Secret.
+func NewSecret(value string) Secret {
+	return Secret{value: value}
+}
+
+// Reveal returns the actual value, only use it where it's really needed.
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+// IsZero reports whether the secret is empty.
+func (s Secret) IsZero() bool {
+	return s.value == ""
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+// Format redacts the value for every fmt verb, including %v, %+v and %#v.
+func (s Secret) Format(f fmt.State, verb rune) {
+	if verb == 'q' {
+		fmt.Fprintf(f, "%q", redacted)
+		return
+	}
+	io.WriteString(f, redacted)
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+func (s *Secret) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &s.value)
+}
+
+func (s *Secret) UnmarshalText(text []byte) error {
+	s.value = string(text)
+	return nil
+}
+
+// IsSecretKey reports whether key matches any of SecretPatterns.
+func IsSecretKey(key string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range SecretPatterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactEnv returns a copy of vars where the values of secret keys (see IsSecretKey)
+// are Secrets, so it's safe to print, e.g. log.Printf("Loaded: %v", shared.RedactEnv(vars)).
+func RedactEnv(vars map[string]string) map[string]any {
+	out := make(map[string]any, len(vars))
+	for key, value := range vars {
+		if IsSecretKey(key) {
+			out[key] = NewSecret(value)
+		} else {
+			out[key] = value
+		}
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+package shared
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// AndroidEmulatorHost is how the Android emulator reaches the host's localhost.
+const AndroidEmulatorHost = "10.0.2.2"
+
+type serverOptions struct {
+	name              string
+	tlsConfig         *tls.Config
+	certFile, keyFile string
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	shutdownTimeout   time.Duration
+}
+
+// ServerOption customizes RunServer.
+type ServerOption func(*serverOptions)
+
+// WithName sets the server name used on logs, e.g. "Stripe Server".
+func WithName(name string) ServerOption {
+	return func(o *serverOptions) { o.name = name }
+}
+
+// WithTLS serves HTTPS with the given cert and key files.
+func WithTLS(certFile, keyFile string) ServerOption {
+	return func(o *serverOptions) { o.certFile, o.keyFile = certFile, keyFile }
+}
+
+// WithTLSConfig serves HTTPS with config, which must contain the certificates
+// unless WithTLS is given too.
+func WithTLSConfig(config *tls.Config) ServerOption {
+	return func(o *serverOptions) { o.tlsConfig = config }
+}
+
+// WithTimeouts replaces the default read (10s), write (30s) and idle (2m) timeouts, 0 disables them.
+func WithTimeouts(read, write, idle time.Duration) ServerOption {
+	return func(o *serverOptions) { o.readTimeout, o.writeTimeout, o.idleTimeout = read, write, idle }
+}
+
+// WithShutdownTimeout replaces how long in flight requests are waited for on shutdown (default 15s).
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(o *serverOptions) { o.shutdownTimeout = timeout }
+}
+
+// RunServer serves handler on addr (e.g. ":8080") until SIGINT or SIGTERM, then shuts down
+// gracefully, waiting for in flight requests up to the shutdown timeout.
+// A nil handler means http.DefaultServeMux.
+//
+//	if err := shared.RunServer(":8080", nil, shared.WithName("Stripe Server")); err != nil {
+//		logging.Fatal("Stripe Server failed", logging.Err(err))
+//	}
+func RunServer(addr string, handler http.Handler, opts ...ServerOption) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return RunServerContext(ctx, addr, handler, opts...)
+}
+
+// RunServerContext is RunServer stopping when ctx is done instead of on signals.
+func RunServerContext(ctx context.Context, addr string, handler http.Handler, opts ...ServerOption) error {
+	o := serverOptions{
+		name:              "Server",
+		readHeaderTimeout: 5 * time.Second,
+		readTimeout:       10 * time.Second,
+		writeTimeout:      30 * time.Second,
+		idleTimeout:       2 * time.Minute,
+		shutdownTimeout:   15 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	useTLS := o.tlsConfig != nil || o.certFile != ""
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		TLSConfig:         o.tlsConfig,
+		ReadHeaderTimeout: o.readHeaderTimeout,
+		ReadTimeout:       o.readTimeout,
+		WriteTimeout:      o.writeTimeout,
+		IdleTimeout:       o.idleTimeout,
+	}
+	if o.readTimeout > 0 && o.readTimeout < o.readHeaderTimeout {
+		server.ReadHeaderTimeout = o.readTimeout
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	logServerURLs(o.name, listener.Addr(), useTLS)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if useTLS {
+			serveErr <- server.ServeTLS(listener, o.certFile, o.keyFile)
+		} else {
+			serveErr <- server.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info(o.name+" shutting down, waiting for in flight requests", "timeout", o.shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), o.shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return fmt.Errorf("shutting down %s: %w", o.name, err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info(o.name + " stopped")
+	return nil
+}
+
+func logServerURLs(name string, addr net.Addr, useTLS bool) {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	port := addr.String()
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		port = fmt.Sprint(tcp.Port)
+	}
+	slog.Info(name+" running",
+		"url", fmt.Sprintf("%s://localhost:%s", scheme, port),
+		// 🤖 Use it on Android emulator
+		"android_url", fmt.Sprintf("%s://%s:%s/<api>", scheme, AndroidEmulatorHost, port))
+}
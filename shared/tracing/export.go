@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// ExporterEnvVar selects where spans go: none (default), stdout or file.
+	ExporterEnvVar = "TRACE_EXPORTER"
+	// FileEnvVar is the file of the file exporter, traces.jsonl by default.
+	FileEnvVar = "TRACE_FILE"
+)
+
+// Exporter receives the ended spans of sampled traces.
+type Exporter interface {
+	Export(SpanData)
+}
+
+var (
+	exporterMu sync.RWMutex
+	exporter   Exporter
+	service    string
+)
+
+// SetExporter sets where spans go, nil drops them.
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+func export(data SpanData) {
+	exporterMu.RLock()
+	e, name := exporter, service
+	exporterMu.RUnlock()
+	if e != nil {
+		data.Service = name
+		e.Export(data)
+	}
+}
+
+// JSONExporter writes a JSON line per span, e.g. to inspect them with jq:
+//
+//	jq -s 'group_by(.trace_id)' traces.jsonl
+type JSONExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONExporter creates a JSONExporter writing to w.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *JSONExporter) Export(data SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(data)
+}
+
+// Setup names the spans of service and sets the exporter from TRACE_EXPORTER and TRACE_FILE.
+// Spans are appended to the file, so services started from the same directory share it.
+// The returned function closes the file.
+func Setup(serviceName string) (func() error, error) {
+	exporterMu.Lock()
+	service = serviceName
+	exporterMu.Unlock()
+
+	switch kind := strings.ToLower(os.Getenv(ExporterEnvVar)); kind {
+	case "", "none":
+		SetExporter(nil)
+	case "stdout":
+		SetExporter(NewJSONExporter(os.Stdout))
+	case "file":
+		path := os.Getenv(FileEnvVar)
+		if path == "" {
+			path = "traces.jsonl"
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening %s: %w", FileEnvVar, err)
+		}
+		SetExporter(NewJSONExporter(f))
+		return f.Close, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown exporter %q, use none, stdout or file", ExporterEnvVar, kind)
+	}
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+)
+
+// Inject sets the traceparent and tracestate headers of the span of ctx, if any.
+func Inject(ctx context.Context, header http.Header) {
+	sc, ok := SpanContextFrom(ctx)
+	if !ok {
+		return
+	}
+	header.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set(TracestateHeader, sc.TraceState)
+	}
+}
+
+// Extract parses the traceparent and tracestate headers, a malformed traceparent is ignored
+// and a new trace is started, as the spec requires.
+func Extract(header http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceparent(header.Get(TraceparentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = header.Get(TracestateHeader)
+	return sc, true
+}
+
+// Transport traces outgoing requests with client spans and propagates the trace context:
+//
+//	client := &http.Client{Transport: tracing.NewTransport(nil)}
+//	req, _ := http.NewRequestWithContext(r.Context(), "POST", url, body)
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewTransport wraps base, http.DefaultTransport when nil.
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := Start(req.Context(), req.Method+" "+req.URL.Host, KindClient)
+	span.SetAttr("http.method", req.Method)
+	span.SetAttr("server.address", req.URL.Host)
+	// Not the query, it may carry tokens
+	span.SetAttr("url.path", req.URL.Path)
+
+	// RoundTrippers must not modify the request
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		return nil, err
+	}
+	span.SetAttr("http.status_code", res.StatusCode)
+	if res.StatusCode >= 500 {
+		span.SetErrorf("%s", res.Status)
+	}
+	span.End()
+	return res, nil
+}
@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"local/shared/logging"
+)
+
+// Kind tells what a span does.
+type Kind string
+
+const (
+	KindInternal Kind = "internal"
+	// KindServer spans handle a request from another service
+	KindServer Kind = "server"
+	// KindClient spans send a request to another service
+	KindClient Kind = "client"
+)
+
+// Span is a timed operation of a trace.
+type Span struct {
+	mu    sync.Mutex
+	data  SpanData
+	sc    SpanContext
+	ended bool
+}
+
+// SpanData is an ended span, as exported.
+type SpanData struct {
+	Name       string         `json:"name"`
+	Service    string         `json:"service,omitempty"`
+	Kind       Kind           `json:"kind"`
+	TraceID    TraceID        `json:"trace_id"`
+	SpanID     SpanID         `json:"span_id"`
+	ParentID   *SpanID        `json:"parent_id,omitempty"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	DurationMs float64        `json:"duration_ms"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Status     string         `json:"status"` // ok or error
+	Error      string         `json:"error,omitempty"`
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// Start starts a span, child of the span of ctx or of the remote parent set with ContextWithRemote,
+// or the root of a new trace. The returned context carries the span, and the trace_id and span_id
+// log fields. End must be called:
+//
+//	ctx, span := tracing.Start(ctx, "capture order", tracing.KindInternal)
+//	defer span.End()
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent, ok := SpanContextFrom(ctx)
+	sc := SpanContext{SpanID: newSpanID()}
+	data := SpanData{Name: name, Kind: kind, Start: time.Now(), Status: "ok"}
+	if ok {
+		sc.TraceID, sc.Flags, sc.TraceState = parent.TraceID, parent.Flags, parent.TraceState
+		parentID := parent.SpanID
+		data.ParentID = &parentID
+	} else {
+		sc.TraceID, sc.Flags = newTraceID(), FlagSampled
+	}
+	data.TraceID, data.SpanID = sc.TraceID, sc.SpanID
+
+	span := &Span{data: data, sc: sc}
+	ctx = context.WithValue(ctx, spanKey{}, span)
+	ctx = logging.With(ctx, slog.String("trace_id", sc.TraceID.String()), slog.String("span_id", sc.SpanID.String()))
+	return ctx, span
+}
+
+// ContextWithRemote sets sc, e.g. parsed from a traceparent header, as the parent of the next span.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// FromContext returns the span of ctx, nil if none. The methods of a nil *Span do nothing.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SpanContextFrom returns the span context of the span of ctx, or the remote one.
+func SpanContextFrom(ctx context.Context) (SpanContext, bool) {
+	if span := FromContext(ctx); span != nil {
+		return span.sc, true
+	}
+	sc, ok := ctx.Value(remoteKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// SpanContext returns what to propagate to other services.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetName renames the span, e.g. once the route is known.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetAttr sets an attribute, e.g. "http.status_code".
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = map[string]any{}
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetError marks the span as failed, if err isn't nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status, s.data.Error = "error", err.Error()
+}
+
+// SetErrorf marks the span as failed with a message, e.g. for 5xx responses.
+func (s *Span) SetErrorf(format string, args ...any) {
+	s.SetError(fmt.Errorf(format, args...))
+}
+
+// End ends the span and exports it when the trace is sampled. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.data.DurationMs = float64(s.data.End.Sub(s.data.Start).Microseconds()) / 1000
+	data := s.data
+	s.mu.Unlock()
+
+	if s.sc.Sampled() {
+		export(data)
+	}
+}
@@ -0,0 +1,126 @@
+// Package tracing follows requests across services with W3C Trace Context
+// (https://www.w3.org/TR/trace-context/) and exports the spans locally, as JSON lines
+// on stdout or on a file, to inspect them offline.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Header names of W3C Trace Context, also used as gRPC metadata keys.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// TraceID identifies a trace, shared by all its spans.
+type TraceID [16]byte
+
+// SpanID identifies a span.
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether id is not all zeros.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// IsValid reports whether id is not all zeros.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// MarshalText writes the hex form, for JSON.
+func (id TraceID) MarshalText() ([]byte, error) { return []byte(id.String()), nil }
+
+// MarshalText writes the hex form, for JSON.
+func (id SpanID) MarshalText() ([]byte, error) { return []byte(id.String()), nil }
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// FlagSampled marks traces whose spans are exported.
+const FlagSampled byte = 0x01
+
+// SpanContext is what crosses process boundaries: the traceparent and tracestate headers.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// TraceState is vendor data, forwarded as is
+	TraceState string
+}
+
+// IsValid reports whether both IDs are set.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Sampled reports whether the spans of the trace are exported.
+func (sc SpanContext) Sampled() bool { return sc.Flags&FlagSampled != 0 }
+
+// Traceparent returns the traceparent header value, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ErrInvalidTraceparent is returned by ParseTraceparent for malformed values.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent parses a traceparent header value. Versions above 00 are parsed as 00,
+// ignoring any extra fields, as the spec requires.
+func ParseTraceparent(value string) (SpanContext, error) {
+	value = strings.TrimSpace(value)
+	// version "-" trace-id "-" parent-id "-" flags
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	version, err := parseHex(value[:2])
+	if err != nil || version[0] == 0xff || !isLowerHex(value[:55]) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	if version[0] == 0 && len(value) != 55 || version[0] > 0 && len(value) > 55 && value[55] != '-' {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	var sc SpanContext
+	traceID, err1 := parseHex(value[3:35])
+	spanID, err2 := parseHex(value[36:52])
+	flags, err3 := parseHex(value[53:55])
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+func parseHex(s string) ([]byte, error) { return hex.DecodeString(s) }
+
+// isLowerHex reports whether s only has lowercase hex digits and dashes, as the spec requires.
+func isLowerHex(s string) bool {
+	for _, c := range []byte(s) {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c == '-') {
+			return false
+		}
+	}
+	return true
+}